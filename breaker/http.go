@@ -18,10 +18,20 @@ func Get(name string, url string) (*http.Response, error) {
 // GetWithFallback will fetch the HTTP resource from url using a GET method, wrapped in a circuit breaker named name.
 // If the operation fails, the fallback function f is called with the previous error as an argument
 func GetWithFallback(name string, url string, f func(error) error) (resp *http.Response, err error) {
+	return do(name, func() (*http.Response, error) { return ht.Default.Get(url) }, f)
+}
+
+// Do will send the HTTP request req, wrapped in a circuit breaker named name. It can be used instead of
+// Get when the request needs custom headers, like conditional requests
+func Do(name string, req *http.Request) (*http.Response, error) {
+	return do(name, func() (*http.Response, error) { return ht.Default.Do(req) }, nil)
+}
+
+func do(name string, send func() (*http.Response, error), f func(error) error) (resp *http.Response, err error) {
 	err = hystrix.Do(name, func() error {
 		start := time.Now()
 		var internalError error
-		if resp, internalError = ht.Default.Get(url); internalError == nil {
+		if resp, internalError = send(); internalError == nil {
 			measureRequest(start, fmt.Sprintf("planb.breaker.%s", name))
 		} else {
 			registerFailure(name)
@@ -79,3 +79,29 @@ func TestCircuitBreakerFailures(t *testing.T) {
 		t.Error("Error is not circuit open: ", err)
 	}
 }
+
+func TestCircuitBreakerDo(t *testing.T) {
+	metrics.UseNilMetrics = true
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"foo"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("If-None-Match", `"foo"`)
+	resp, err := Do("do", req)
+	if err != nil {
+		t.Fatal("Failed to send request: ", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Request headers were not sent. Wanted status %d, got %d", http.StatusNotModified, resp.StatusCode)
+	}
+}
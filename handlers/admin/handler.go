@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+	"github.com/zalando/planb-tokeninfo/revoke"
+)
+
+const tokenParameter = "token"
+
+type adminHandler struct {
+	crp         *revoke.CachingRevokeProvider
+	credentials map[string]string
+}
+
+// CheckResponse tells whether a token would be revoked and by which revocation
+type CheckResponse struct {
+	JWT        bool               `json:"jwt"`
+	Revoked    bool               `json:"revoked"`
+	Revocation *revoke.Revocation `json:"revocation,omitempty"`
+}
+
+// NewHandler returns an http.Handler for the admin endpoints, meant for a separate listener:
+//
+//	GET /admin/revocations shows the contents of the revocation cache
+//	POST /admin/revocations/check tells if the token from the form parameter "token" would be revoked
+//
+// Callers must authenticate with HTTP Basic authentication using one of the user/password pairs in credentials
+func NewHandler(crp *revoke.CachingRevokeProvider, credentials map[string]string) http.Handler {
+	h := &adminHandler{crp: crp, credentials: credentials}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/revocations", h.status)
+	mux.HandleFunc("/admin/revocations/check", h.check)
+	return h.authenticated(mux)
+}
+
+func (h *adminHandler) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !h.authenticate(req) {
+			incCounter("planb.tokeninfo.admin.errors.unauthorized")
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+			tokeninfo.ErrInvalidClient.Write(w)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (h *adminHandler) authenticate(req *http.Request) bool {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, has := h.credentials[user]
+	if !has {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+}
+
+func (h *adminHandler) status(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, h.crp.Status())
+}
+
+// check looks for the revocation of the token. The claims of JWTs are read without validating the token, so
+// that the revocations of expired tokens or tokens with unknown keys can also be checked. Other tokens are only
+// checked against the TOKEN revocations
+func (h *adminHandler) check(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := req.PostFormValue(tokenParameter)
+	if token == "" {
+		tokeninfo.ErrInvalidRequest.Write(w)
+		return
+	}
+
+	resp := new(CheckResponse)
+	var claims map[string]interface{}
+	if strings.Count(token, ".") == 2 {
+		mc := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(token, mc); err != nil {
+			log.Println("Failed to parse the token to check: ", err)
+			tokeninfo.ErrInvalidRequest.Write(w)
+			return
+		}
+		resp.JWT = true
+		claims = mc
+	}
+	resp.Revocation = h.crp.FindRevocation(token, claims)
+	resp.Revoked = resp.Revocation != nil
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to finish admin response: ", err)
+	}
+}
+
+func incCounter(key string) {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/zalando/planb-tokeninfo/revoke"
+)
+
+func TestAdmin(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Minute).Unix()
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"revocations": [
+			{"type": "GLOBAL", "revoked_at": %d, "data": {"issued_before": %d}},
+			{"type": "CLAIM", "revoked_at": %d, "data": {"names": ["uid"], "value_hash": "hash", "issued_before": %d}}
+		]}`, revokedAt, revokedAt, revokedAt, revokedAt)
+	}))
+	defer provider.Close()
+	u, _ := url.Parse(provider.URL)
+	crp := revoke.NewCachingRevokeProvider(u)
+	crp.RefreshRevocations()
+
+	h := NewHandler(crp, map[string]string{"admin": "secret"})
+
+	oldToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "jdoe", "iat": revokedAt - 60}).SignedString([]byte("key"))
+	newToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "jdoe", "iat": revokedAt + 30}).SignedString([]byte("key"))
+
+	for _, test := range []struct {
+		method      string
+		path        string
+		password    string
+		token       string
+		wantCode    int
+		wantBody    string
+		wantRevoked bool
+	}{
+		{"GET", "/admin/revocations", "wrong", "", http.StatusUnauthorized, `"invalid_client"`, false},
+		{"GET", "/admin/revocations", "secret", "", http.StatusOK, fmt.Sprintf(`"counts":{"CLAIM":1,"GLOBAL":1},"last_revocation_timestamp":%d`, revokedAt), false},
+		{"POST", "/admin/revocations", "secret", "", http.StatusMethodNotAllowed, "", false},
+		{"GET", "/admin/revocations/check", "secret", "", http.StatusMethodNotAllowed, "", false},
+		{"POST", "/admin/revocations/check", "secret", "", http.StatusBadRequest, `"invalid_request"`, false},
+		{"POST", "/admin/revocations/check", "secret", "not.a.jwt", http.StatusBadRequest, `"invalid_request"`, false},
+		{"POST", "/admin/revocations/check", "secret", "opaque", http.StatusOK, `"jwt":false,"revoked":false`, false},
+		{"POST", "/admin/revocations/check", "secret", oldToken, http.StatusOK, `"jwt":true,"revoked":true,"revocation":{"Type":"GLOBAL"`, true},
+		{"POST", "/admin/revocations/check", "secret", newToken, http.StatusOK, `"jwt":true,"revoked":false`, false},
+	} {
+		form := url.Values{}
+		if test.token != "" {
+			form.Set("token", test.token)
+		}
+		req, _ := http.NewRequest(test.method, "http://example.com"+test.path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", test.password)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for %s %s %q. Wanted %d, got %d", test.method, test.path, test.token, test.wantCode, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), test.wantBody) {
+			t.Errorf("Wrong response body for %s %s %q. Wanted %s, got %s", test.method, test.path, test.token, test.wantBody, w.Body.String())
+		}
+		if test.path == "/admin/revocations/check" && w.Code == http.StatusOK {
+			resp := new(CheckResponse)
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil || resp.Revoked != test.wantRevoked {
+				t.Errorf("Wrong check response for %q: %s", test.token, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package batch
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+)
+
+// maxTokenSize limits the request body to a sane size per token in the batch
+const maxTokenSize = 16 * 1024
+
+type batchHandler struct {
+	tokenInfo http.Handler
+	maxSize   int
+}
+
+// NewHandler returns an http.Handler that validates a batch of tokens in a single request. Every token is
+// validated by the tokenInfo http.Handler, so it goes through the same routing, JWT validation, revocation
+// checks and upstream proxy cache as the tokeninfo endpoint. Batches with more than maxSize tokens are rejected
+func NewHandler(tokenInfo http.Handler, maxSize int) http.Handler {
+	return &batchHandler{tokenInfo: tokenInfo, maxSize: maxSize}
+}
+
+// ServeHTTP validates the JSON array of tokens in the request body. The response is a JSON array with the
+// result for each token, in the same order. The result is either the token info or an error object
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tokens []string
+	body := http.MaxBytesReader(w, req.Body, int64(h.maxSize+1)*maxTokenSize)
+	if err := json.NewDecoder(body).Decode(&tokens); err != nil {
+		incCounter("planb.tokeninfo.batch.errors.invalid_request")
+		tokeninfo.ErrInvalidBatch.Write(w)
+		return
+	}
+
+	if len(tokens) > h.maxSize {
+		incCounter("planb.tokeninfo.batch.errors.too_large")
+		tokeninfo.ErrBatchTooLarge.Write(w)
+		return
+	}
+
+	results := make([]json.RawMessage, len(tokens))
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			results[i] = h.validate(req, token)
+		}(i, token)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Println("Failed to finish batch response: ", err)
+	}
+	updateHistogram("planb.tokeninfo.batch.size", len(tokens))
+	measureRequest(start, "planb.tokeninfo.batch")
+}
+
+// validate returns the tokeninfo response body for the token, or an error object if the response wasn't JSON
+func (h *batchHandler) validate(req *http.Request, token string) json.RawMessage {
+	rw, err := tokeninfo.ServeToken(h.tokenInfo, req, token)
+	if err != nil {
+		log.Println("Failed to validate token in batch: ", err)
+		return errorResult(tokeninfo.ErrTemporarilyUnavailable)
+	}
+
+	body := rw.Body.Bytes()
+	if !json.Valid(body) {
+		if rw.StatusCode == http.StatusOK {
+			log.Println("Invalid token info in batch: ", string(body))
+		}
+		return errorResult(tokeninfo.ErrTemporarilyUnavailable)
+	}
+	return json.RawMessage(body)
+}
+
+func errorResult(e tokeninfo.Error) json.RawMessage {
+	e.Reason = ""
+	buf, _ := json.Marshal(e)
+	return json.RawMessage(buf)
+}
+
+func measureRequest(start time.Time, key string) {
+	if t, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewTimer).(metrics.Timer); ok {
+		t.UpdateSince(start)
+	}
+}
+
+func updateHistogram(key string, v int) {
+	if h, ok := metrics.DefaultRegistry.GetOrRegister(key, func() metrics.Histogram {
+		return metrics.NewHistogram(metrics.NewUniformSample(1028))
+	}).(metrics.Histogram); ok {
+		h.Update(int64(v))
+	}
+}
+
+func incCounter(key string) {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
@@ -0,0 +1,81 @@
+package batch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+)
+
+const testTokenInfo = `{"access_token":"valid","uid":"jdoe"}`
+
+type testTokenInfoHandler struct{}
+
+func (h *testTokenInfoHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch tokeninfo.AccessTokenFromRequest(req) {
+	case "valid":
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(testTokenInfo))
+	case "timeout":
+		w.WriteHeader(http.StatusGatewayTimeout)
+		w.Write([]byte("Gateway Timeout"))
+	case "":
+		tokeninfo.ErrInvalidRequest.Write(w)
+	default:
+		tokeninfo.ErrInvalidToken.Write(w)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	h := NewHandler(&testTokenInfoHandler{}, 4)
+	for _, test := range []struct {
+		method      string
+		body        string
+		wantCode    int
+		wantResults []string
+	}{
+		{"GET", `["valid"]`, http.StatusMethodNotAllowed, nil},
+		{"POST", `not json`, http.StatusBadRequest, nil},
+		{"POST", `{"token":"valid"}`, http.StatusBadRequest, nil},
+		{"POST", `["a","b","c","d","e"]`, http.StatusRequestEntityTooLarge, nil},
+		{"POST", `[]`, http.StatusOK, []string{}},
+		{"POST", `["valid"]`, http.StatusOK, []string{""}},
+		{"POST", `["valid","invalid","","timeout"]`, http.StatusOK, []string{"", "invalid_token", "invalid_request", "temporarily_unavailable"}},
+	} {
+		req, _ := http.NewRequest(test.method, "http://example.com/oauth2/tokeninfo/batch", strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for %s. Wanted %d, got %d", test.body, test.wantCode, w.Code)
+		}
+
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var results []map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Errorf("Failed to decode the batch response: %v", err)
+			continue
+		}
+
+		if len(results) != len(test.wantResults) {
+			t.Errorf("Wrong number of results for %s. Wanted %d, got %d", test.body, len(test.wantResults), len(results))
+			continue
+		}
+
+		for i, want := range test.wantResults {
+			if want == "" {
+				if results[i]["uid"] != "jdoe" {
+					t.Errorf("Wanted token info for result %d of %s, got %v", i, test.body, results[i])
+				}
+			} else if results[i]["error"] != want {
+				t.Errorf("Wrong error for result %d of %s. Wanted %q, got %v", i, test.body, want, results[i]["error"])
+			}
+		}
+	}
+}
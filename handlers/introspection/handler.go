@@ -0,0 +1,200 @@
+package introspection
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+)
+
+const tokenParameter = "token"
+
+type introspectionHandler struct {
+	tokenInfo http.Handler
+	clients   map[string]string
+}
+
+// Response is the OAuth 2.0 Token Introspection response
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc7662#section-2.2
+type Response struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientId  string      `json:"client_id,omitempty"`
+	Username  string      `json:"username,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Aud       interface{} `json:"aud,omitempty"`
+	Realm     string      `json:"realm,omitempty"`
+}
+
+var inactive = &Response{Active: false}
+
+// NewHandler returns an http.Handler for the OAuth 2.0 Token Introspection endpoint. Every token is
+// validated by the tokenInfo http.Handler, so it goes through the same routing, JWT validation,
+// revocation checks and upstream proxy as the tokeninfo endpoint. Callers must authenticate with
+// HTTP Basic authentication using one of the client id/secret pairs in clients
+func NewHandler(tokenInfo http.Handler, clients map[string]string) http.Handler {
+	return &introspectionHandler{tokenInfo: tokenInfo, clients: clients}
+}
+
+// ServeHTTP introspects the token from the POST form parameter "token". Invalid tokens result in an
+// inactive response instead of an error
+func (h *introspectionHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authenticate(req) {
+		incCounter("planb.tokeninfo.introspection.errors.invalid_client")
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspection"`)
+		tokeninfo.ErrInvalidClient.Write(w)
+		return
+	}
+
+	token := req.PostFormValue(tokenParameter)
+	if token == "" {
+		incCounter("planb.tokeninfo.introspection.errors.invalid_request")
+		tokeninfo.ErrInvalidRequest.Write(w)
+		return
+	}
+
+	rw, err := tokeninfo.ServeToken(h.tokenInfo, req, token)
+	if err != nil {
+		log.Println("Failed to introspect token: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if rw.StatusCode >= http.StatusInternalServerError || rw.StatusCode == http.StatusTooManyRequests {
+		// not a verdict about the token, so don't pretend it's inactive
+		incCounter("planb.tokeninfo.introspection.errors.upstream")
+		w.WriteHeader(rw.StatusCode)
+		w.Write(rw.Body.Bytes())
+		return
+	}
+
+	resp := inactive
+	if rw.StatusCode == http.StatusOK {
+		resp, err = newResponse(rw.Body.Bytes(), start)
+		if err != nil {
+			log.Println("Failed to parse the token info: ", err)
+			resp = inactive
+		}
+	}
+
+	if resp.Active {
+		incCounter("planb.tokeninfo.introspection.active")
+	} else {
+		incCounter("planb.tokeninfo.introspection.inactive")
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("Failed to finish introspection response: ", err)
+	}
+	measureRequest(start, "planb.tokeninfo.introspection")
+}
+
+func (h *introspectionHandler) authenticate(req *http.Request) bool {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, has := h.clients[id]
+	if !has {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+// newResponse copies the fields of the token info needed by the introspection response. The token info is read
+// as a generic JSON object, as it may come from the upstream and have fields of unexpected types, like an "aud"
+// array, that are either passed through or ignored
+func newResponse(body []byte, now time.Time) (*Response, error) {
+	ti := make(map[string]interface{})
+	if err := json.Unmarshal(body, &ti); err != nil {
+		return nil, err
+	}
+	resp := &Response{
+		Active:    true,
+		Scope:     scope(ti["scope"]),
+		ClientId:  stringField(ti, "client_id"),
+		Username:  stringField(ti, "uid"),
+		TokenType: stringField(ti, "token_type"),
+		Sub:       stringField(ti, "uid"),
+		Aud:       audience(ti["aud"]),
+		Realm:     stringField(ti, "realm"),
+	}
+	if exp, ok := ti["expires_in"].(float64); ok {
+		resp.Exp = now.Add(time.Duration(exp) * time.Second).Unix()
+	}
+	return resp, nil
+}
+
+func stringField(ti map[string]interface{}, name string) string {
+	s, _ := ti[name].(string)
+	return s
+}
+
+// scope returns the space separated scopes of either a JSON array or a string
+func scope(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []interface{}:
+		scopes := make([]string, 0, len(s))
+		for _, e := range s {
+			if e, ok := e.(string); ok {
+				scopes = append(scopes, e)
+			}
+		}
+		return strings.Join(scopes, " ")
+	}
+	return ""
+}
+
+// audience returns the audience if it's a string or an array of strings, which RFC 7662 both allows
+func audience(v interface{}) interface{} {
+	switch a := v.(type) {
+	case string:
+		if a != "" {
+			return a
+		}
+	case []interface{}:
+		aud := make([]string, 0, len(a))
+		for _, e := range a {
+			if e, ok := e.(string); ok {
+				aud = append(aud, e)
+			}
+		}
+		if len(aud) > 0 {
+			return aud
+		}
+	}
+	return nil
+}
+
+func measureRequest(start time.Time, key string) {
+	if t, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewTimer).(metrics.Timer); ok {
+		t.UpdateSince(start)
+	}
+}
+
+func incCounter(key string) {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
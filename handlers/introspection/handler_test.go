@@ -0,0 +1,101 @@
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+)
+
+const testTokenInfo = `{"access_token":"valid","client_id":"my-client","expires_in":42,"grant_type":"password","realm":"/services","scope":["uid","cn"],"token_type":"Bearer","uid":"jdoe"}`
+
+type testTokenInfoHandler struct{}
+
+func (h *testTokenInfoHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch tokeninfo.AccessTokenFromRequest(req) {
+	case "valid":
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(testTokenInfo))
+	case "audiences":
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"access_token":"audiences","aud":["a","b"],"expires_in":42,"realm":"/services","scope":["uid","cn"],"uid":"jdoe","client_id":"my-client"}`))
+	case "garbage":
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("not json"))
+	case "timeout":
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		tokeninfo.ErrInvalidToken.Write(w)
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	h := NewHandler(&testTokenInfoHandler{}, map[string]string{"gateway": "secret"})
+	for _, test := range []struct {
+		method     string
+		user       string
+		password   string
+		token      string
+		wantCode   int
+		wantActive bool
+	}{
+		{"GET", "gateway", "secret", "valid", http.StatusMethodNotAllowed, false},
+		{"POST", "", "", "valid", http.StatusUnauthorized, false},
+		{"POST", "gateway", "wrong", "valid", http.StatusUnauthorized, false},
+		{"POST", "unknown", "secret", "valid", http.StatusUnauthorized, false},
+		{"POST", "gateway", "secret", "", http.StatusBadRequest, false},
+		{"POST", "gateway", "secret", "invalid", http.StatusOK, false},
+		{"POST", "gateway", "secret", "garbage", http.StatusOK, false},
+		{"POST", "gateway", "secret", "timeout", http.StatusGatewayTimeout, false},
+		{"POST", "gateway", "secret", "valid", http.StatusOK, true},
+		{"POST", "gateway", "secret", "audiences", http.StatusOK, true},
+	} {
+		form := url.Values{}
+		if test.token != "" {
+			form.Set("token", test.token)
+		}
+		req, _ := http.NewRequest(test.method, "http://example.com/oauth2/introspect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for token %q. Wanted %d, got %d", test.token, test.wantCode, w.Code)
+		}
+
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var resp Response
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Errorf("Failed to decode the introspection response: %v", err)
+		}
+
+		if resp.Active != test.wantActive {
+			t.Errorf("Wrong active state for token %q. Wanted %t, got %t", test.token, test.wantActive, resp.Active)
+		}
+
+		if !test.wantActive && resp != (Response{}) {
+			t.Errorf("Inactive response should not contain anything else: %+v", resp)
+		}
+
+		if test.wantActive {
+			if resp.Scope != "uid cn" || resp.Sub != "jdoe" || resp.ClientId != "my-client" || resp.Realm != "/services" || resp.Exp == 0 {
+				t.Errorf("Unexpected introspection response: %+v", resp)
+			}
+		}
+
+		if test.token == "audiences" && !reflect.DeepEqual(resp.Aud, []interface{}{"a", "b"}) {
+			t.Errorf("Wrong audience in the introspection response. Wanted [a b], got %v", resp.Aud)
+		}
+	}
+}
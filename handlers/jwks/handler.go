@@ -17,9 +17,14 @@ func NewHandler(kl keyloader.KeyLoader) http.Handler {
 	return &jwksHandler{loader: kl}
 }
 
-// ServeHTTP serializes the current snapshot of Keys from the KeyLoader as a JSON Web Key Set
+// ServeHTTP serializes the current snapshot of Keys from the KeyLoader as a JSON Web Key Set. If the KeyLoader
+// is a keyloader.KeyPublisher, only its PublishedKeys are served
 func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	wrapper := &jwksWrapper{keys: h.loader.Keys()}
+	keys := h.loader.Keys()
+	if p, ok := h.loader.(keyloader.KeyPublisher); ok {
+		keys = p.PublishedKeys()
+	}
+	wrapper := &jwksWrapper{keys: keys}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(wrapper); err != nil {
 		log.Println("Failed to finish JWKS response: ", err)
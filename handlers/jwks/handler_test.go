@@ -2,6 +2,7 @@ package jwks
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
@@ -24,6 +25,7 @@ const (
 		"kFEo0sVdfG0Rlw"
 	ecdsaX = "FDrM1mhj9Q4gvELNEVSe6UPKNjjVuAtgt04ro9dCchU"
 	ecdsaY = "HTGUAM_1N_9bDYOW2W_nRDX64JXw41ja6DxpbSPaEsA"
+	okpX   = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
 )
 
 type mockKeyLoader struct {
@@ -54,6 +56,12 @@ func mockValidKeys() map[string]interface{} {
 				Y:     new(big.Int).SetBytes(mustDecode(ecdsaY)),
 			},
 		},
+		"key3": jwk.JSONWebKey{
+			Algorithm: "EdDSA",
+			KeyID:     "key3",
+			Use:       "sig",
+			Key:       ed25519.PublicKey(mustDecode(okpX)),
+		},
 	}
 }
 
@@ -90,6 +98,33 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+type mockKeyPublisher struct {
+	mockKeyLoader
+	published map[string]interface{}
+}
+
+func (kl *mockKeyPublisher) PublishedKeys() map[string]interface{} { return kl.published }
+
+func TestPublishedKeys(t *testing.T) {
+	keys := mockValidKeys()
+	published := map[string]interface{}{"key1": keys["key1"]}
+	h := NewHandler(&mockKeyPublisher{mockKeyLoader: mockKeyLoader{theKeys: keys}, published: published})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/oauth2/v3/keys", nil)
+
+	h.ServeHTTP(w, r)
+
+	jwks := new(jwk.JSONWebKeySet)
+	if err := json.NewDecoder(w.Body).Decode(jwks); err != nil {
+		t.Error("Failed to recover the response to a JWKS object")
+	}
+
+	if m := jwks.ToMap(); !reflect.DeepEqual(m, published) {
+		t.Errorf("JWKS should only contain the published keys. Got %v", m)
+	}
+}
+
 func TestFailure(t *testing.T) {
 	kl := &mockKeyLoader{theKeys: map[string]interface{}{"foo": "bar"}}
 	h := NewHandler(kl)
@@ -2,6 +2,7 @@ package jwks
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
@@ -17,7 +18,7 @@ type jwksWrapper struct {
 }
 
 func (j *jwksWrapper) MarshalJSON() ([]byte, error) {
-	keys := make([]map[string]string, len(j.keys))
+	keys := make([]map[string]interface{}, len(j.keys))
 	i := 0
 	for k, v := range j.keys {
 		key, ok := v.(jwk.JSONWebKey)
@@ -33,11 +34,11 @@ func (j *jwksWrapper) MarshalJSON() ([]byte, error) {
 		keys[i] = m
 		i++
 	}
-	return json.Marshal(map[string][]map[string]string{"keys": keys})
+	return json.Marshal(map[string][]map[string]interface{}{"keys": keys})
 }
 
-func fromJwk(k jwk.JSONWebKey) (map[string]string, error) {
-	m := map[string]string{
+func fromJwk(k jwk.JSONWebKey) (map[string]interface{}, error) {
+	m := map[string]interface{}{
 		"use": k.Use,
 		"kid": k.KeyID,
 		"alg": k.Algorithm,
@@ -47,20 +48,46 @@ func fromJwk(k jwk.JSONWebKey) (map[string]string, error) {
 		ecThumbprintInput(m, key)
 	case *rsa.PublicKey:
 		rsaThumbprintInput(m, key)
+	case ed25519.PublicKey:
+		okpThumbprintInput(m, key)
 	default:
 		return nil, fmt.Errorf("Unkown key type %q", reflect.TypeOf(key))
 	}
+	certificates(m, k)
 	return m, nil
 }
 
-func ecThumbprintInput(m map[string]string, pkey *ecdsa.PublicKey) {
+// certificates adds the x5c chain and the thumbprints of the key, when available
+func certificates(m map[string]interface{}, k jwk.JSONWebKey) {
+	if len(k.Certificates) > 0 {
+		x5c := make([]string, len(k.Certificates))
+		for i, c := range k.Certificates {
+			x5c[i] = base64.StdEncoding.EncodeToString(c.Raw)
+		}
+		m["x5c"] = x5c
+	}
+	if k.CertificateThumbprintSHA1 != nil {
+		m["x5t"] = base64.RawURLEncoding.EncodeToString(k.CertificateThumbprintSHA1)
+	}
+	if k.CertificateThumbprintSHA256 != nil {
+		m["x5t#S256"] = base64.RawURLEncoding.EncodeToString(k.CertificateThumbprintSHA256)
+	}
+}
+
+func ecThumbprintInput(m map[string]interface{}, pkey *ecdsa.PublicKey) {
 	m["kty"] = "EC"
 	m["crv"] = pkey.Curve.Params().Name
 	m["x"] = base64.RawURLEncoding.EncodeToString(pkey.X.Bytes())
 	m["y"] = base64.RawURLEncoding.EncodeToString(pkey.Y.Bytes())
 }
 
-func rsaThumbprintInput(m map[string]string, pkey *rsa.PublicKey) {
+func okpThumbprintInput(m map[string]interface{}, pkey ed25519.PublicKey) {
+	m["kty"] = "OKP"
+	m["crv"] = "Ed25519"
+	m["x"] = base64.RawURLEncoding.EncodeToString(pkey)
+}
+
+func rsaThumbprintInput(m map[string]interface{}, pkey *rsa.PublicKey) {
 	m["kty"] = "RSA"
 	m["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pkey.E)).Bytes())
 	m["n"] = base64.RawURLEncoding.EncodeToString(pkey.N.Bytes())
@@ -2,8 +2,16 @@ package jwks
 
 import (
 	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
 )
@@ -34,8 +42,8 @@ func TestWrapper(t *testing.T) {
 		t.Error("Content doesn't contain a list of keys")
 	}
 
-	if len(keys) != 2 {
-		t.Errorf("Unexpected amount of keys in the response. Wanted 2, got %d\n", len(keys))
+	if len(keys) != 3 {
+		t.Errorf("Unexpected amount of keys in the response. Wanted 3, got %d\n", len(keys))
 	}
 
 	commonAttrs := []string{"alg", "use", "kty"}
@@ -71,12 +79,60 @@ func TestWrapper(t *testing.T) {
 			if y, has := key["y"]; !has || y != ecdsaY {
 				t.Errorf("Invalid/Missing Y coordinate for ECDSA key %q. Wanted %q, got %q", key["kid"], ecdsaY, key["n"])
 			}
+		case "OKP":
+			if alg, has := key["alg"]; !has || alg != "EdDSA" {
+				t.Errorf("Invalid/Missing algorithm for OKP key %q. Wanted EdDSA, got %q", key["kid"], key["alg"])
+			}
+			if crv, has := key["crv"]; !has || crv != "Ed25519" {
+				t.Errorf("Invalid/Missing curve for OKP key %q. Wanted Ed25519, got %q", key["kid"], key["crv"])
+			}
+			if x, has := key["x"]; !has || x != okpX {
+				t.Errorf("Invalid/Missing public key `x` for OKP key %q. Wanted %q, got %q", key["kid"], okpX, key["x"])
+			}
 		default:
 			t.Errorf("Recovered key %q has an invalid algorithm: %q", key["kid"], key["kty"])
 		}
 	}
 }
 
+func TestCertificates(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	thumbprint := sha256.Sum256(der)
+
+	m, err := fromJwk(jwk.JSONWebKey{
+		Algorithm:                   "ES256",
+		Use:                         "sig",
+		KeyID:                       "key4",
+		Key:                         &key.PublicKey,
+		Certificates:                []*x509.Certificate{cert},
+		CertificateThumbprintSHA256: thumbprint[:],
+	})
+	if err != nil {
+		t.Fatal("Failed to convert the JWK: ", err)
+	}
+
+	if x5c, ok := m["x5c"].([]string); !ok || len(x5c) != 1 || x5c[0] != base64.StdEncoding.EncodeToString(der) {
+		t.Errorf("Invalid/Missing x5c: %v", m["x5c"])
+	}
+
+	if m["x5t#S256"] != base64.RawURLEncoding.EncodeToString(thumbprint[:]) {
+		t.Errorf("Invalid/Missing x5t#S256: %v", m["x5t#S256"])
+	}
+
+	if _, has := m["x5t"]; has {
+		t.Error("The x5t thumbprint should not be published when unknown")
+	}
+
+	b, _ := json.Marshal(m)
+	k := new(jwk.JSONWebKey)
+	if err := json.Unmarshal(b, k); err != nil {
+		t.Error("Failed to parse the republished JWK: ", err)
+	}
+}
+
 func TestFailures(t *testing.T) {
 	jwk := jwk.JSONWebKey{
 		Algorithm: "ERROR",
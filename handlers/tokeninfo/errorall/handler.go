@@ -19,9 +19,9 @@ func NewErrorAllHandler() http.Handler {
 func (h *errorAllHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var tie tokeninfo.Error
 	if tokeninfo.AccessTokenFromRequest(req) == "" {
-		tie = tokeninfo.ErrInvalidRequest
+		tie = tokeninfo.ErrInvalidRequest.WithReason(tokeninfo.ReasonMissingToken)
 	} else {
-		tie = tokeninfo.ErrInvalidToken
+		tie = tokeninfo.ErrInvalidToken.WithReason(tokeninfo.ReasonUnsupportedToken)
 	}
 	registerError(tie)
 	tie.Write(w)
@@ -29,7 +29,13 @@ func (h *errorAllHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func registerError(err tokeninfo.Error) {
-	key := fmt.Sprintf("planb.tokeninfo.nonjwt.errors.%s", err.Error)
+	incCounter(fmt.Sprintf("planb.tokeninfo.nonjwt.errors.%s", err.Error))
+	if err.Reason != "" {
+		incCounter(fmt.Sprintf("planb.tokeninfo.nonjwt.errors.%s.%s", err.Error, err.Reason))
+	}
+}
+
+func incCounter(key string) {
 	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
 		c.Inc(1)
 	}
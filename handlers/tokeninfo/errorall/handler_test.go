@@ -6,7 +6,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/rcrowley/go-metrics"
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 type testHandler struct {
@@ -44,3 +46,35 @@ func TestInvalidToken(t *testing.T) {
 		t.Errorf("expected invalid_token response, but got %q", w.Body.String())
 	}
 }
+
+func TestErrorReasons(t *testing.T) {
+	options.AppSettings.ErrorReasons = true
+	defer func() { options.AppSettings.ErrorReasons = false }()
+	h := NewErrorAllHandler()
+
+	for _, test := range []struct {
+		auth string
+		want string
+	}{
+		{"", `"error_reason":"missing_token"`},
+		{"Bearer 1234", `"error_reason":"unsupported_token"`},
+	} {
+		req := &http.Request{Header: make(http.Header)}
+		req.Header.Set("Authorization", test.auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("expected %s in the response, but got %q", test.want, w.Body.String())
+		}
+	}
+}
+
+func TestRegisterErrorWithoutReason(t *testing.T) {
+	registerError(tokeninfo.ErrInvalidClient)
+	if metrics.DefaultRegistry.Get("planb.tokeninfo.nonjwt.errors.invalid_client") == nil {
+		t.Error("expected the error to be counted")
+	}
+	if metrics.DefaultRegistry.Get("planb.tokeninfo.nonjwt.errors.invalid_client.") != nil {
+		t.Error("errors without a reason should not be counted with an empty reason")
+	}
+}
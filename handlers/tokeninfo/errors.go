@@ -2,29 +2,91 @@ package tokeninfo
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 // Error type is used to wrap standard error messages that can be easily marshaled to JSON
 type Error struct {
 	Error            string `json:"error"`
 	ErrorDescription string `json:"error_description"`
+	Reason           string `json:"error_reason,omitempty"`
 	statusCode       int
+	scope            string
 }
 
+// Machine readable reasons for rejecting a token. They are only sent to the clients when
+// options.AppSettings.ErrorReasons is enabled
+const (
+	ReasonMissingToken         = "missing_token"
+	ReasonMalformed            = "malformed"
+	ReasonUnsupportedToken     = "unsupported_token"
+	ReasonUnsupportedAlgorithm = "unsupported_algorithm"
+	ReasonUnknownKeyID         = "unknown_kid"
+	ReasonAlgorithmMismatch    = "algorithm_mismatch"
+	ReasonInvalidKeyUse        = "invalid_key_use"
+	ReasonBadSignature         = "bad_signature"
+	ReasonIssuerMismatch       = "issuer_mismatch"
+	ReasonExpired              = "expired"
+	ReasonNotValidYet          = "not_valid_yet"
+	ReasonIssuedInFuture       = "issued_in_future"
+	ReasonMissingClaim         = "missing_claim"
+	ReasonInvalidAudience      = "invalid_audience"
+	ReasonRevoked              = "revoked"
+	ReasonMissingScope         = "missing_scope"
+	ReasonRealmMismatch        = "realm_mismatch"
+)
+
 var (
 	// ErrInvalidRequest should be used whenever the receiver failed to parse the request
-	ErrInvalidRequest = Error{"invalid_request", "Access Token not valid", http.StatusBadRequest}
+	ErrInvalidRequest = Error{Error: "invalid_request", ErrorDescription: "Access Token not valid", statusCode: http.StatusBadRequest}
 	// ErrInvalidToken should be used whenever the receiver failed to validate a JWT Token
-	ErrInvalidToken = Error{"invalid_token", "Access Token not valid", http.StatusUnauthorized}
+	ErrInvalidToken = Error{Error: "invalid_token", ErrorDescription: "Access Token not valid", statusCode: http.StatusUnauthorized}
+	// ErrInvalidClient should be used whenever the client authentication failed
+	ErrInvalidClient = Error{Error: "invalid_client", ErrorDescription: "Client authentication failed", statusCode: http.StatusUnauthorized}
+	// ErrInsufficientScope should be used whenever a valid token doesn't have the required scopes or realm
+	ErrInsufficientScope = Error{Error: "insufficient_scope", ErrorDescription: "Access Token has insufficient privileges", statusCode: http.StatusForbidden}
+	// ErrInvalidBatch should be used whenever the receiver failed to parse a batch of tokens
+	ErrInvalidBatch = Error{Error: "invalid_request", ErrorDescription: "Batch of Access Tokens not valid", statusCode: http.StatusBadRequest}
+	// ErrBatchTooLarge should be used whenever a batch has more tokens than allowed
+	ErrBatchTooLarge = Error{Error: "invalid_request", ErrorDescription: "Too many Access Tokens in the batch", statusCode: http.StatusRequestEntityTooLarge}
+	// ErrTemporarilyUnavailable should be used whenever a token couldn't be validated because of a server error
+	ErrTemporarilyUnavailable = Error{Error: "temporarily_unavailable", ErrorDescription: "Access Token could not be validated", statusCode: http.StatusServiceUnavailable}
 )
 
-// Write will write the Error e to the response writer, marshaled as JSON, and with the respective Status Code
+// WithReason returns a copy of the Error e with the machine readable reason code
+func (e Error) WithReason(reason string) Error {
+	e.Reason = reason
+	return e
+}
+
+// Write will write the Error e to the response writer, marshaled as JSON, and with the respective Status Code.
+// When error reasons are enabled, the reason is also sent in the WWW-Authenticate header, as well as the
+// required scope of an insufficient_scope error
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc6750#section-3
 func (e *Error) Write(w http.ResponseWriter) {
+	out := *e
+	if !options.AppSettings.ErrorReasons {
+		out.Reason = ""
+	}
 	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-	w.WriteHeader(e.statusCode)
-	if err := json.NewEncoder(w).Encode(e); err != nil {
+	if out.Reason != "" || out.scope != "" {
+		challenge := fmt.Sprintf(`Bearer error="%s", error_description="%s"`, out.Error, out.ErrorDescription)
+		if out.scope != "" {
+			challenge += fmt.Sprintf(`, scope="%s"`, out.scope)
+		}
+		if out.Reason != "" {
+			challenge += fmt.Sprintf(`, error_reason="%s"`, out.Reason)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	w.WriteHeader(out.statusCode)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
 		log.Println("Failed to finish error response: ", err)
 	}
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 func TestErrorEncoding(t *testing.T) {
@@ -41,3 +43,48 @@ func TestErrorEncoding(t *testing.T) {
 
 	}
 }
+
+func TestErrorReasons(t *testing.T) {
+	defer func() { options.AppSettings.ErrorReasons = false }()
+	for _, test := range []struct {
+		enabled    bool
+		given      Error
+		want       string
+		wantHeader string
+	}{
+		{
+			false,
+			ErrInvalidToken.WithReason(ReasonExpired),
+			`{"error":"invalid_token","error_description":"Access Token not valid"}` + "\n",
+			"",
+		},
+		{
+			true,
+			ErrInvalidToken,
+			`{"error":"invalid_token","error_description":"Access Token not valid"}` + "\n",
+			"",
+		},
+		{
+			true,
+			ErrInvalidToken.WithReason(ReasonExpired),
+			`{"error":"invalid_token","error_description":"Access Token not valid","error_reason":"expired"}` + "\n",
+			`Bearer error="invalid_token", error_description="Access Token not valid", error_reason="expired"`,
+		},
+	} {
+		options.AppSettings.ErrorReasons = test.enabled
+		w := httptest.NewRecorder()
+		test.given.Write(w)
+
+		if w.Body.String() != test.want {
+			t.Errorf("Wrong body. Wanted %q, got %q", test.want, w.Body.String())
+		}
+
+		if h := w.Header().Get("WWW-Authenticate"); h != test.wantHeader {
+			t.Errorf("Wrong WWW-Authenticate header. Wanted %q, got %q", test.wantHeader, h)
+		}
+	}
+
+	if ErrInvalidToken.Reason != "" {
+		t.Error("WithReason should not modify the original error")
+	}
+}
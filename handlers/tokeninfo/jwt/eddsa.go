@@ -0,0 +1,59 @@
+package jwthandler
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningMethodEdDSA implements the EdDSA signing method with Ed25519 keys
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc8037#section-3.1
+type SigningMethodEdDSA struct{}
+
+var (
+	// ErrInvalidEd25519Key should be used whenever the key for the EdDSA signing method is not an Ed25519 key
+	ErrInvalidEd25519Key = errors.New("Key is not a valid Ed25519 key")
+
+	signingMethodEdDSA = &SigningMethodEdDSA{}
+)
+
+func init() {
+	jwt.RegisterSigningMethod(signingMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return signingMethodEdDSA
+	})
+}
+
+// Alg returns the name of the signing method in the JWT header
+func (m *SigningMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify checks the signature of the signingString with the ed25519.PublicKey key
+func (m *SigningMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return ErrInvalidEd25519Key
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign signs the signingString with the ed25519.PrivateKey key
+func (m *SigningMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok || len(priv) != ed25519.PrivateKeySize {
+		return "", ErrInvalidEd25519Key
+	}
+	return jwt.EncodeSegment(ed25519.Sign(priv, []byte(signingString))), nil
+}
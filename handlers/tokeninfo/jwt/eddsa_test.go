@@ -0,0 +1,48 @@
+package jwthandler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Failed to generate the Ed25519 key: ", err)
+	}
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	if jwt.GetSigningMethod("EdDSA") != signingMethodEdDSA {
+		t.Fatal("The EdDSA signing method should be registered")
+	}
+
+	s, err := jwt.NewWithClaims(signingMethodEdDSA, jwt.MapClaims{"sub": "foo"}).SignedString(priv)
+	if err != nil {
+		t.Fatal("Failed to sign the token: ", err)
+	}
+
+	for _, test := range []struct {
+		key       interface{}
+		wantValid bool
+	}{
+		{pub, true},
+		{otherPub, false},
+		{[]byte(pub), false},
+		{ed25519.PublicKey("short"), false},
+	} {
+		token, err := jwt.Parse(s, func(*jwt.Token) (interface{}, error) { return test.key, nil })
+		if test.wantValid && (err != nil || !token.Valid) {
+			t.Errorf("Token should be valid with key %v: %v", test.key, err)
+		}
+		if !test.wantValid && err == nil {
+			t.Errorf("Token should not be valid with key %v", test.key)
+		}
+	}
+
+	if _, err := signingMethodEdDSA.Sign("foo", "not a key"); err != ErrInvalidEd25519Key {
+		t.Errorf("Wrong error for an invalid private key: %v", err)
+	}
+}
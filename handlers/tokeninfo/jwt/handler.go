@@ -8,10 +8,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/dgrijalva/jwt-go/request"
 	"github.com/rcrowley/go-metrics"
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
 	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/options"
 	"github.com/zalando/planb-tokeninfo/processor"
 	"github.com/zalando/planb-tokeninfo/revoke"
 )
@@ -21,6 +23,8 @@ type jwtHandler struct {
 	crp       *revoke.CachingRevokeProvider
 }
 
+const metricsIssuerMismatch = "planb.tokeninfo.jwt.errors.issuer_mismatch"
+
 var (
 	ErrInvalidJWT   = errors.New("Invalid JWT token.")
 	ErrRevokedToken = errors.New("Token is revoked.")
@@ -37,6 +41,11 @@ func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	ti, err := h.validateToken(r)
 	if err == nil && ti != nil {
+		if tie, ok := tokeninfo.RequirementsFromRequest(r).Check(ti); !ok {
+			registerError(tie)
+			tie.Write(w)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if err := Marshal(ti, w); err != nil {
@@ -54,14 +63,66 @@ func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	default:
 		tie = tokeninfo.ErrInvalidToken
 	}
+	tie = tie.WithReason(rejectionReason(err))
 	registerError(tie)
 	tie.Write(w)
 }
 
+// rejectionReason maps the errors from the token validation to the machine readable reason codes
+func rejectionReason(err error) string {
+	if ve, ok := err.(*jwt.ValidationError); ok {
+		switch {
+		case ve.Inner == keyloader.ErrIssuerMismatch:
+			return tokeninfo.ReasonIssuerMismatch
+		case ve.Inner == ErrAlgorithmMismatch:
+			return tokeninfo.ReasonAlgorithmMismatch
+		case ve.Inner == ErrInvalidKeyUse:
+			return tokeninfo.ReasonInvalidKeyUse
+		case ve.Inner == ErrMissingKeyID, ve.Inner == ErrInvalidKeyID, ve.Inner == ErrUnknownKeyID:
+			return tokeninfo.ReasonUnknownKeyID
+		case ve.Inner == ErrUnsupportedSigningMethod, ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+			return tokeninfo.ReasonUnsupportedAlgorithm
+		case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return tokeninfo.ReasonBadSignature
+		default:
+			return tokeninfo.ReasonMalformed
+		}
+	}
+
+	if _, ok := err.(*processor.ClaimError); ok {
+		return tokeninfo.ReasonMissingClaim
+	}
+
+	switch err {
+	case request.ErrNoTokenInRequest:
+		return tokeninfo.ReasonMissingToken
+	case ErrRevokedToken:
+		return tokeninfo.ReasonRevoked
+	case ErrTokenExpired:
+		return tokeninfo.ReasonExpired
+	case ErrTokenNotValidYet:
+		return tokeninfo.ReasonNotValidYet
+	case ErrTokenIssuedInFuture:
+		return tokeninfo.ReasonIssuedInFuture
+	case ErrAudienceNotAllowed, ErrInvalidClaimAud:
+		return tokeninfo.ReasonInvalidAudience
+	case ErrInvalidClaimScope, ErrInvalidClaimRealm, ErrInvalidClaimSub, ErrInvalidClaimAzp,
+		ErrInvalidClaimExp, ErrInvalidClaimNbf, ErrInvalidClaimIat:
+		return tokeninfo.ReasonMissingClaim
+	default:
+		return ""
+	}
+}
+
 func (h *jwtHandler) validateToken(req *http.Request) (*processor.TokenInfo, error) {
 	start := time.Now()
-	token, err := request.ParseFromRequest(req, request.OAuth2Extractor, jwtValidator(h.keyLoader))
+	// the time based claims are validated below, taking the configured leeway into account
+	parser := request.WithParser(&jwt.Parser{SkipClaimsValidation: true})
+	token, err := request.ParseFromRequest(req, request.OAuth2Extractor, jwtValidator(h.keyLoader), parser)
 	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok && ve.Inner == keyloader.ErrIssuerMismatch {
+			incCounter(metricsIssuerMismatch)
+		}
 		log.Println("Failed to validate token: ", err)
 		return nil, err
 	}
@@ -71,6 +132,11 @@ func (h *jwtHandler) validateToken(req *http.Request) (*processor.TokenInfo, err
 		log.Println("Failed to validate token: ", ErrInvalidJWT)
 		return nil, ErrInvalidJWT
 	}
+	if err := validateTimeClaims(token, time.Now(), options.AppSettings.JwtLeeway); err != nil {
+		incCounter(timeClaimsErrorMetrics[err])
+		log.Println("Failed to validate token: ", err)
+		return nil, err
+	}
 	if h.crp.IsJWTRevoked(token) {
 		log.Println("Failed to validate token: ", ErrRevokedToken)
 		return nil, ErrRevokedToken
@@ -97,7 +163,13 @@ func measureRequest(start time.Time, key string) {
 }
 
 func registerError(err tokeninfo.Error) {
-	key := fmt.Sprintf("planb.tokeninfo.jwt.errors.%s", err.Error)
+	incCounter(fmt.Sprintf("planb.tokeninfo.jwt.errors.%s", err.Error))
+	if err.Reason != "" {
+		incCounter(fmt.Sprintf("planb.tokeninfo.jwt.errors.%s.%s", err.Error, err.Reason))
+	}
+}
+
+func incCounter(key string) {
 	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
 		c.Inc(1)
 	}
@@ -2,6 +2,8 @@ package jwthandler
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
@@ -13,7 +15,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/options"
 	"github.com/zalando/planb-tokeninfo/processor"
 	"github.com/zalando/planb-tokeninfo/revoke"
 )
@@ -27,6 +35,11 @@ var (
 	testECDSAPKey *ecdsa.PublicKey
 	testRSAPKey   *rsa.PublicKey
 
+	// private key used to sign test tokens with the key id "test"
+	testSigningKey *rsa.PrivateKey
+	// private key used to sign test tokens with the key id "ed25519"
+	testEd25519Key ed25519.PrivateKey
+
 	keyMap map[string]interface{}
 )
 
@@ -43,6 +56,10 @@ func (kl *mockKeyLoader) Keys() map[string]interface{} {
 }
 
 func init() {
+	testSigningKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	testEd25519Key = edPriv
+
 	data, _ := ioutil.ReadFile("testdata/rs256.pub")
 	block, _ := pem.Decode(data)
 	pkey, _ := x509.ParsePKIXPublicKey(block.Bytes)
@@ -60,11 +77,38 @@ func init() {
 	testECDSAToken = string(ecdsa)
 
 	keyMap = map[string]interface{}{
-		"RS256": testRSAPKey,
-		"ES256": testECDSAPKey,
+		"RS256":   testRSAPKey,
+		"ES256":   testECDSAPKey,
+		"test":    &testSigningKey.PublicKey,
+		"ed25519": edPub,
 	}
 }
 
+// signTestToken returns a token with the claims signed by the testSigningKey. The claims not
+// specified are filled with valid values
+func signTestToken(claims jwt.MapClaims) string {
+	return signTestTokenWith(jwt.SigningMethodRS256, "test", testSigningKey, claims)
+}
+
+// signTestTokenWith is like signTestToken but with a different signing method and key
+func signTestTokenWith(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	c := jwt.MapClaims{
+		"iss":   "PlanB",
+		"sub":   "foo",
+		"realm": "/test",
+		"scope": []interface{}{"uid"},
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+	token := jwt.NewWithClaims(method, c)
+	token.Header["kid"] = kid
+	s, _ := token.SignedString(key)
+	return s
+}
+
 func TestHandler(t *testing.T) {
 	kl := new(mockKeyLoader)
 	u, _ := url.Parse("localhost")
@@ -106,6 +150,200 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+func TestIssuerMismatch(t *testing.T) {
+	u, _ := url.Parse("localhost")
+	crp := revoke.NewCachingRevokeProvider(u)
+	c := metrics.DefaultRegistry.GetOrRegister(metricsIssuerMismatch, metrics.NewCounter).(metrics.Counter)
+
+	for _, test := range []struct {
+		issuer       string
+		wantCode     int
+		wantMismatch int64
+	}{
+		{"PlanB", http.StatusOK, 0},
+		{"Partner", http.StatusUnauthorized, 1},
+	} {
+		before := c.Count()
+		h := New(&mockIssuerKeyLoader{issuer: test.issuer}, crp)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+testRSAToken, nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for issuer %q. Wanted %d, got %d", test.issuer, test.wantCode, w.Code)
+		}
+
+		if c.Count()-before != test.wantMismatch {
+			t.Errorf("Wrong issuer mismatch count for issuer %q. Wanted %d, got %d", test.issuer, test.wantMismatch, c.Count()-before)
+		}
+	}
+}
+
+func TestLeeway(t *testing.T) {
+	defer func() { options.AppSettings.JwtLeeway = 0 }()
+	kl := new(mockKeyLoader)
+	u, _ := url.Parse("localhost")
+	h := New(kl, revoke.NewCachingRevokeProvider(u))
+
+	now := time.Now().Unix()
+	for _, test := range []struct {
+		claims   jwt.MapClaims
+		leeway   time.Duration
+		wantCode int
+	}{
+		{jwt.MapClaims{}, 0, http.StatusOK},
+		{jwt.MapClaims{"iat": now + 2}, 0, http.StatusUnauthorized},
+		{jwt.MapClaims{"iat": now + 2}, 5 * time.Second, http.StatusOK},
+		{jwt.MapClaims{"iat": now + 3600}, 5 * time.Second, http.StatusUnauthorized},
+		{jwt.MapClaims{"nbf": now + 2}, 0, http.StatusUnauthorized},
+		{jwt.MapClaims{"nbf": now + 2}, 5 * time.Second, http.StatusOK},
+		{jwt.MapClaims{"exp": now - 2}, 0, http.StatusUnauthorized},
+		{jwt.MapClaims{"exp": now - 2}, 5 * time.Second, http.StatusOK},
+	} {
+		options.AppSettings.JwtLeeway = test.leeway
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+signTestToken(test.claims), nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for claims %v with leeway %v. Wanted %d, got %d", test.claims, test.leeway, test.wantCode, w.Code)
+		}
+	}
+}
+
+func TestSigningMethods(t *testing.T) {
+	kl := new(mockKeyLoader)
+	u, _ := url.Parse("localhost")
+	h := New(kl, revoke.NewCachingRevokeProvider(u))
+
+	for _, test := range []struct {
+		token    string
+		wantCode int
+	}{
+		{signTestTokenWith(jwt.SigningMethodRS256, "test", testSigningKey, nil), http.StatusOK},
+		{signTestTokenWith(jwt.SigningMethodPS256, "test", testSigningKey, nil), http.StatusOK},
+		{signTestTokenWith(jwt.SigningMethodPS512, "test", testSigningKey, nil), http.StatusOK},
+		{signTestTokenWith(signingMethodEdDSA, "ed25519", testEd25519Key, nil), http.StatusOK},
+		{signTestTokenWith(signingMethodEdDSA, "test", testEd25519Key, nil), http.StatusUnauthorized},
+		{signTestTokenWith(jwt.SigningMethodPS256, "ed25519", testSigningKey, nil), http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+test.token, nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for %s. Wanted %d, got %d", test.token, test.wantCode, w.Code)
+		}
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	kl := new(mockKeyLoader)
+	u, _ := url.Parse("localhost")
+	h := New(kl, revoke.NewCachingRevokeProvider(u))
+
+	token := signTestToken(jwt.MapClaims{"scope": []interface{}{"uid", "cn"}})
+	for _, test := range []struct {
+		query    string
+		wantCode int
+	}{
+		{"", http.StatusOK},
+		{"&required_scope=uid", http.StatusOK},
+		{"&required_scope=uid&required_scope=cn&required_realm=/test", http.StatusOK},
+		{"&required_scope=uid+cn", http.StatusOK},
+		{"&required_scope=write", http.StatusForbidden},
+		{"&required_scope=uid&required_realm=/services", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+token+test.query, nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for %q. Wanted %d, got %d", test.query, test.wantCode, w.Code)
+		}
+
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+			t.Errorf("Missing insufficient_scope challenge for %q: %s", test.query, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestRejectionReasons(t *testing.T) {
+	options.AppSettings.ErrorReasons = true
+	defer func() { options.AppSettings.ErrorReasons = false }()
+	kl := new(mockKeyLoader)
+	u, _ := url.Parse("localhost")
+	h := New(kl, revoke.NewCachingRevokeProvider(u))
+
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "foo"})
+	unknownKid.Header["kid"] = "unknown"
+	unknownKidToken, _ := unknownKid.SignedString(testSigningKey)
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "foo"}).SignedString([]byte("secret"))
+	valid := signTestToken(jwt.MapClaims{})
+	badSignature := valid[:len(valid)-4] + "AAAA"
+
+	for _, test := range []struct {
+		token      string
+		wantCode   int
+		wantReason string
+	}{
+		{"", http.StatusBadRequest, tokeninfo.ReasonMissingToken},
+		{"foo", http.StatusUnauthorized, tokeninfo.ReasonMalformed},
+		{unknownKidToken, http.StatusUnauthorized, tokeninfo.ReasonUnknownKeyID},
+		{hmacToken, http.StatusUnauthorized, tokeninfo.ReasonUnsupportedAlgorithm},
+		{badSignature, http.StatusUnauthorized, tokeninfo.ReasonBadSignature},
+		{signTestToken(jwt.MapClaims{"exp": time.Now().Unix() - 10}), http.StatusUnauthorized, tokeninfo.ReasonExpired},
+		{signTestToken(jwt.MapClaims{"realm": 42}), http.StatusUnauthorized, tokeninfo.ReasonMissingClaim},
+	} {
+		c := metrics.DefaultRegistry.GetOrRegister("planb.tokeninfo.jwt.errors.invalid_token."+test.wantReason, metrics.NewCounter).(metrics.Counter)
+		before := c.Count()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+test.token, nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.wantCode {
+			t.Errorf("Wrong status code for reason %q. Wanted %d, got %d", test.wantReason, test.wantCode, w.Code)
+		}
+
+		var e tokeninfo.Error
+		if err := json.NewDecoder(w.Body).Decode(&e); err != nil || e.Reason != test.wantReason {
+			t.Errorf("Wrong reason. Wanted %q, got %q (%v)", test.wantReason, e.Reason, err)
+		}
+
+		if !strings.Contains(w.Header().Get("WWW-Authenticate"), `error_reason="`+test.wantReason+`"`) {
+			t.Errorf("Wrong WWW-Authenticate header for reason %q: %q", test.wantReason, w.Header().Get("WWW-Authenticate"))
+		}
+
+		if test.wantCode == http.StatusUnauthorized && c.Count() != before+1 {
+			t.Errorf("Error metric for reason %q was not incremented", test.wantReason)
+		}
+	}
+}
+
+func TestRejectionReasonMapping(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{ErrRevokedToken, tokeninfo.ReasonRevoked},
+		{ErrTokenNotValidYet, tokeninfo.ReasonNotValidYet},
+		{ErrTokenIssuedInFuture, tokeninfo.ReasonIssuedInFuture},
+		{ErrAudienceNotAllowed, tokeninfo.ReasonInvalidAudience},
+		{ErrInvalidClaimSub, tokeninfo.ReasonMissingClaim},
+		{&processor.ClaimError{Claim: "preferred_username"}, tokeninfo.ReasonMissingClaim},
+		{&jwt.ValidationError{Inner: keyloader.ErrIssuerMismatch, Errors: jwt.ValidationErrorUnverifiable}, tokeninfo.ReasonIssuerMismatch},
+		{&jwt.ValidationError{Inner: ErrMissingKeyID, Errors: jwt.ValidationErrorUnverifiable}, tokeninfo.ReasonUnknownKeyID},
+		{&jwt.ValidationError{Inner: ErrAlgorithmMismatch, Errors: jwt.ValidationErrorUnverifiable}, tokeninfo.ReasonAlgorithmMismatch},
+		{&jwt.ValidationError{Inner: ErrInvalidKeyUse, Errors: jwt.ValidationErrorUnverifiable}, tokeninfo.ReasonInvalidKeyUse},
+		{ErrInvalidJWT, ""},
+	} {
+		if r := rejectionReason(test.err); r != test.want {
+			t.Errorf("Wrong reason for error %v. Wanted %q, got %q", test.err, test.want, r)
+		}
+	}
+}
+
 func TestRoutingMatch(t *testing.T) {
 	kl := new(mockKeyLoader)
 	u, _ := url.Parse("localhost")
@@ -2,10 +2,12 @@ package jwthandler
 
 import (
 	"errors"
-	"fmt"
+	"log"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 var (
@@ -13,15 +15,28 @@ var (
 	ErrMissingKeyID = errors.New("Missing key Id in the JWT header")
 	// ErrInvalidKeyID should be used when the content of the kid attribute is invalid
 	ErrInvalidKeyID = errors.New("Invalid key Id in the JWT header")
+	// ErrUnknownKeyID should be used when there is no key for the kid attribute
+	ErrUnknownKeyID = errors.New("Unknown key Id in the JWT header")
+	// ErrUnsupportedSigningMethod should be used when the alg attribute is not supported
+	ErrUnsupportedSigningMethod = errors.New("Unsupported signing method in the JWT header")
+	// ErrAlgorithmMismatch should be used when the alg attribute doesn't match the algorithm of the key
+	ErrAlgorithmMismatch = errors.New("Signing method doesn't match the key algorithm")
+	// ErrInvalidKeyUse should be used when the key was not published for signatures
+	ErrInvalidKeyUse = errors.New("Key is not meant for signatures")
 )
 
 func jwtValidator(kl keyloader.KeyLoader) jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
+		if !algorithmAllowed(token.Method.Alg(), options.AppSettings.AllowedAlgorithms) {
+			log.Printf("Signing method not allowed: %v", token.Header["alg"])
+			return nil, ErrUnsupportedSigningMethod
+		}
 		switch token.Method.(type) {
-		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *SigningMethodEdDSA:
 			return loadKey(kl, token)
 		default:
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			log.Printf("Unexpected signing method: %v", token.Header["alg"])
+			return nil, ErrUnsupportedSigningMethod
 		}
 	}
 }
@@ -38,5 +53,57 @@ func loadKey(kl keyloader.KeyLoader, t *jwt.Token) (interface{}, error) {
 		return nil, ErrInvalidKeyID
 	}
 
-	return kl.LoadKey(id)
+	var key interface{}
+	var err error
+	// keys from different issuers can share the same id and a key must only be used for
+	// tokens of its own issuer. A missing issuer claim never matches
+	iss, _ := ClaimAsString(t, JwtClaimIssuer)
+	switch l := kl.(type) {
+	case keyloader.JWKLoader:
+		var k jwk.JSONWebKey
+		if k, err = l.LoadIssuerJWK(iss, id); err == nil {
+			if err = checkKeyBinding(t, k); err != nil {
+				log.Printf("Rejecting key %q for the token: %v", id, err)
+				return nil, err
+			}
+		}
+		key = k.Key
+	case keyloader.IssuerKeyLoader:
+		key, err = l.LoadIssuerKey(iss, id)
+	default:
+		key, err = kl.LoadKey(id)
+	}
+
+	if err != nil && err != keyloader.ErrIssuerMismatch {
+		log.Printf("Failed to load key %q: %v", id, err)
+		return nil, ErrUnknownKeyID
+	}
+	return key, err
+}
+
+// checkKeyBinding verifies that the key k was published for signatures and that the signing method of the
+// token t is the algorithm of the key. With LenientKeyBinding, keys without a use are also accepted, as are
+// keys without an algorithm, for any signing method of their key type
+func checkKeyBinding(t *jwt.Token, k jwk.JSONWebKey) error {
+	lenient := options.AppSettings.LenientKeyBinding
+	if k.Use != "sig" && (k.Use != "" || !lenient) {
+		return ErrInvalidKeyUse
+	}
+	if k.Algorithm != t.Method.Alg() && (k.Algorithm != "" || !lenient) {
+		return ErrAlgorithmMismatch
+	}
+	return nil
+}
+
+// algorithmAllowed returns true if the alg is in the allowed list or if the list is empty
+func algorithmAllowed(alg string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+	return false
 }
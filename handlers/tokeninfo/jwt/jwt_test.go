@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 func TestLoadKey(t *testing.T) {
@@ -61,3 +64,117 @@ func TestJwtValidator(t *testing.T) {
 		}
 	}
 }
+
+type mockIssuerKeyLoader struct {
+	mockKeyLoader
+	issuer string
+}
+
+func (kl *mockIssuerKeyLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	if issuer != kl.issuer {
+		return nil, keyloader.ErrIssuerMismatch
+	}
+	return kl.LoadKey(id)
+}
+
+func (kl *mockIssuerKeyLoader) Issuers() []string {
+	return []string{kl.issuer}
+}
+
+func TestLoadIssuerKey(t *testing.T) {
+	kl := &mockIssuerKeyLoader{issuer: "PlanB"}
+	for _, test := range []struct {
+		claims    jwt.MapClaims
+		want      interface{}
+		wantError error
+	}{
+		{jwt.MapClaims{"iss": "PlanB"}, testRSAPKey, nil},
+		{jwt.MapClaims{"iss": "Partner"}, nil, keyloader.ErrIssuerMismatch},
+		{jwt.MapClaims{"iss": 42}, nil, keyloader.ErrIssuerMismatch},
+		{jwt.MapClaims{}, nil, keyloader.ErrIssuerMismatch},
+	} {
+		token := &jwt.Token{Header: map[string]interface{}{"kid": "RS256"}, Claims: test.claims}
+		k, err := loadKey(kl, token)
+
+		if test.wantError != err {
+			t.Errorf("Unexpected error status. Wanted %v, got %v", test.wantError, err)
+		}
+
+		if k != test.want {
+			t.Errorf("Unexpected key loaded. Wanted %v, got %v", test.want, k)
+		}
+	}
+}
+
+type mockJWKLoader struct {
+	mockIssuerKeyLoader
+	alg string
+	use string
+}
+
+func (kl *mockJWKLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	k, err := kl.LoadIssuerKey(issuer, id)
+	if err != nil {
+		return jwk.JSONWebKey{}, err
+	}
+	return jwk.JSONWebKey{Key: k, KeyID: id, Algorithm: kl.alg, Use: kl.use}, nil
+}
+
+func TestKeyBinding(t *testing.T) {
+	defer func(lenient bool) { options.AppSettings.LenientKeyBinding = lenient }(options.AppSettings.LenientKeyBinding)
+	for _, test := range []struct {
+		alg       string
+		use       string
+		method    jwt.SigningMethod
+		lenient   bool
+		want      interface{}
+		wantError error
+	}{
+		{"RS256", "sig", jwt.SigningMethodRS256, false, testRSAPKey, nil},
+		{"", "", jwt.SigningMethodRS512, false, nil, ErrInvalidKeyUse},
+		{"", "", jwt.SigningMethodRS512, true, testRSAPKey, nil},
+		{"RS256", "", jwt.SigningMethodRS256, false, nil, ErrInvalidKeyUse},
+		{"RS256", "", jwt.SigningMethodRS256, true, testRSAPKey, nil},
+		{"", "sig", jwt.SigningMethodPS256, false, nil, ErrAlgorithmMismatch},
+		{"", "sig", jwt.SigningMethodPS256, true, testRSAPKey, nil},
+		{"RS256", "sig", jwt.SigningMethodRS512, false, nil, ErrAlgorithmMismatch},
+		{"RS256", "sig", jwt.SigningMethodPS256, false, nil, ErrAlgorithmMismatch},
+		{"RS256", "sig", jwt.SigningMethodPS256, true, nil, ErrAlgorithmMismatch},
+		{"RS256", "enc", jwt.SigningMethodRS256, false, nil, ErrInvalidKeyUse},
+		{"", "enc", jwt.SigningMethodRS256, true, nil, ErrInvalidKeyUse},
+	} {
+		options.AppSettings.LenientKeyBinding = test.lenient
+		kl := &mockJWKLoader{mockIssuerKeyLoader: mockIssuerKeyLoader{issuer: "PlanB"}, alg: test.alg, use: test.use}
+		token := &jwt.Token{Method: test.method, Header: map[string]interface{}{"kid": "RS256"}, Claims: jwt.MapClaims{"iss": "PlanB"}}
+		k, err := loadKey(kl, token)
+
+		if test.wantError != err {
+			t.Errorf("Unexpected error for key %q/%q and method %s (lenient: %t). Wanted %v, got %v", test.alg, test.use, test.method.Alg(), test.lenient, test.wantError, err)
+		}
+
+		if k != test.want {
+			t.Errorf("Unexpected key loaded. Wanted %v, got %v", test.want, k)
+		}
+	}
+}
+
+func TestAllowedAlgorithms(t *testing.T) {
+	options.AppSettings.AllowedAlgorithms = []string{"ES256", "EdDSA"}
+	defer func() { options.AppSettings.AllowedAlgorithms = nil }()
+
+	kf := jwtValidator(new(mockKeyLoader))
+	for _, test := range []struct {
+		method    jwt.SigningMethod
+		wantError error
+	}{
+		{jwt.SigningMethodRS256, ErrUnsupportedSigningMethod},
+		{jwt.SigningMethodPS256, ErrUnsupportedSigningMethod},
+		{jwt.SigningMethodES256, nil},
+		{signingMethodEdDSA, nil},
+	} {
+		token := &jwt.Token{Method: test.method, Header: map[string]interface{}{"kid": "ES256"}}
+		if _, err := kf(token); err != test.wantError {
+			t.Errorf("Unexpected error for %s. Wanted %v, got %v", test.method.Alg(), test.wantError, err)
+		}
+	}
+}
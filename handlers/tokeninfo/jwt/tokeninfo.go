@@ -19,6 +19,7 @@ const (
 	JwtClaimAzp    = "azp"
 	JwtClaimExp    = "exp"
 	JwtClaimIssuer = "iss"
+	JwtClaimAud    = "aud"
 )
 
 var (
@@ -32,6 +33,10 @@ var (
 	ErrInvalidClaimAzp = errors.New("Invalid claim: azp")
 	// ErrInvalidClaimExp should be used whenever the claim exp is invalid or missing in the JWT
 	ErrInvalidClaimExp = errors.New("Invalid claim: exp")
+	// ErrInvalidClaimAud should be used whenever the claim aud is invalid or missing in the JWT
+	ErrInvalidClaimAud = errors.New("Invalid claim: aud")
+	// ErrAudienceNotAllowed should be used whenever none of the audiences in the JWT is accepted
+	ErrAudienceNotAllowed = errors.New("Audience not allowed")
 )
 
 func Marshal(ti *processor.TokenInfo, w io.Writer) error {
@@ -62,6 +67,10 @@ func Marshal(ti *processor.TokenInfo, w io.Writer) error {
 		m["client_id"] = ti.ClientId
 	}
 
+	if ti.Audience != "" {
+		m["aud"] = ti.Audience
+	}
+
 	for k, v := range ti.PrivateClaims {
 		m[k] = v
 	}
@@ -115,7 +124,61 @@ func defaultNewTokenInfo(t *jwt.Token, timeBase time.Time) (*processor.TokenInfo
 	}, nil
 }
 
+// NewTokenInfo checks the audience of the token, if there are allowed audiences configured, and maps
+// the token claims to a TokenInfo using the JwtProcessor for the token issuer or the default mapping.
+// The exposed claims from the settings are added to the PrivateClaims
 func NewTokenInfo(t *jwt.Token, timeBase time.Time) (*processor.TokenInfo, error) {
+	aud, err := matchAudience(t, options.AppSettings.AllowedAudiences)
+	if err != nil {
+		return nil, err
+	}
+
+	ti, err := processToken(t, timeBase)
+	if err != nil {
+		return nil, err
+	}
+	ti.Audience = aud
+	exposeClaims(t, ti, options.AppSettings.ExposedClaims)
+	return ti, nil
+}
+
+// reservedClaims are the Token Info fields that can't be replaced by exposed claims
+var reservedClaims = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"uid":           true,
+	"grant_type":    true,
+	"scope":         true,
+	"realm":         true,
+	"client_id":     true,
+	"token_type":    true,
+	"expires_in":    true,
+	"aud":           true,
+}
+
+// exposeClaims copies the claims in the allow-list from the token to the PrivateClaims of the TokenInfo,
+// keeping their JSON types. Claims already set by the JwtProcessor and the standard Token Info fields are
+// left untouched
+func exposeClaims(t *jwt.Token, ti *processor.TokenInfo, exposed []string) {
+	for _, name := range exposed {
+		if reservedClaims[name] {
+			continue
+		}
+		if _, has := ti.PrivateClaims[name]; has {
+			continue
+		}
+		c, ok := getClaim(t, name)
+		if !ok {
+			continue
+		}
+		if ti.PrivateClaims == nil {
+			ti.PrivateClaims = make(map[string]interface{})
+		}
+		ti.PrivateClaims[name] = c
+	}
+}
+
+func processToken(t *jwt.Token, timeBase time.Time) (*processor.TokenInfo, error) {
 	issuer, ok := ClaimAsString(t, JwtClaimIssuer)
 	if ok {
 		jwtprocessor, found := options.AppSettings.JwtProcessors[issuer]
@@ -126,6 +189,47 @@ func NewTokenInfo(t *jwt.Token, timeBase time.Time) (*processor.TokenInfo, error
 	return defaultNewTokenInfo(t, timeBase)
 }
 
+// matchAudience returns the first audience from the aud claim (either a string or an array of strings)
+// that is also in the allowed list. If the allowed list is empty, every token is accepted and no
+// audience is returned
+func matchAudience(t *jwt.Token, allowed []string) (string, error) {
+	if len(allowed) == 0 {
+		return "", nil
+	}
+
+	c, ok := getClaim(t, JwtClaimAud)
+	if !ok {
+		return "", ErrInvalidClaimAud
+	}
+
+	var audiences []string
+	switch aud := c.(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, v := range aud {
+			s, ok := v.(string)
+			if !ok {
+				log.Printf("Invalid string array value for claim %q = %v", JwtClaimAud, c)
+				return "", ErrInvalidClaimAud
+			}
+			audiences = append(audiences, s)
+		}
+	default:
+		log.Printf("Invalid audience value for claim %q = %v", JwtClaimAud, c)
+		return "", ErrInvalidClaimAud
+	}
+
+	for _, aud := range audiences {
+		for _, a := range allowed {
+			if aud == a {
+				return aud, nil
+			}
+		}
+	}
+	return "", ErrAudienceNotAllowed
+}
+
 func ClaimAsStrings(t *jwt.Token, claim string) ([]string, bool) {
 	if c, ok := getClaim(t, claim); ok {
 		value, ok := c.([]interface{})
@@ -150,9 +150,14 @@ func TestMarshal(t *testing.T) {
 			Realm:     "/test",
 			ExpiresIn: 1},
 			"{\"access_token\":\"\",\"bar\":true,\"expires_in\":1,\"foo\":true,\"grant_type\":\"password\",\"realm\":\"/test\",\"scope\":[\"uid\",\"foo\",\"bar\"],\"token_type\":\"Bearer\",\"uid\":\"foo\"}\n"},
+		{&processor.TokenInfo{Audience: "my-service"},
+			"{\"access_token\":\"\",\"aud\":\"my-service\",\"expires_in\":0,\"grant_type\":\"\",\"realm\":\"\",\"scope\":null,\"token_type\":\"\",\"uid\":\"\"}\n"},
 		{&processor.TokenInfo{
-			PrivateClaims: map[string]string{"foo": "bar"}},
+			PrivateClaims: map[string]interface{}{"foo": "bar"}},
 			"{\"access_token\":\"\",\"expires_in\":0,\"foo\":\"bar\",\"grant_type\":\"\",\"realm\":\"\",\"scope\":null,\"token_type\":\"\",\"uid\":\"\"}\n"},
+		{&processor.TokenInfo{
+			PrivateClaims: map[string]interface{}{"n": float64(42), "b": true, "o": map[string]interface{}{"a": []interface{}{"x"}}}},
+			"{\"access_token\":\"\",\"b\":true,\"expires_in\":0,\"grant_type\":\"\",\"n\":42,\"o\":{\"a\":[\"x\"]},\"realm\":\"\",\"scope\":null,\"token_type\":\"\",\"uid\":\"\"}\n"},
 	} {
 		buf := new(bytes.Buffer)
 		Marshal(test.token, buf)
@@ -162,3 +167,79 @@ func TestMarshal(t *testing.T) {
 		}
 	}
 }
+
+func TestExposedClaims(t *testing.T) {
+	options.AppSettings.ExposedClaims = []string{"https://identity.zalando.com/managed-id", "groups", "uid", "missing"}
+	defer func() { options.AppSettings.ExposedClaims = nil }()
+
+	token := &jwt.Token{Claims: jwt.MapClaims{
+		"scope":  []interface{}{"uid"},
+		"sub":    "foo",
+		"realm":  "/test",
+		"exp":    float64(43),
+		"uid":    "bar",
+		"groups": []interface{}{"a", "b"},
+		"https://identity.zalando.com/managed-id": "jdoe",
+		"not-exposed": true,
+	}}
+	ti, err := NewTokenInfo(token, time.Unix(42, 0))
+	if err != nil {
+		t.Fatal("Unexpected error: ", err)
+	}
+
+	want := map[string]interface{}{
+		"groups": []interface{}{"a", "b"},
+		"https://identity.zalando.com/managed-id": "jdoe",
+	}
+	if !reflect.DeepEqual(ti.PrivateClaims, want) {
+		t.Errorf("Unexpected private claims. Wanted %v, got %v", want, ti.PrivateClaims)
+	}
+
+	if ti.UID != "foo" {
+		t.Errorf("The uid should not be replaced by an exposed claim, got %q", ti.UID)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	defer func() { options.AppSettings.AllowedAudiences = nil }()
+	claims := func(aud interface{}) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"scope": []interface{}{"uid"},
+			"sub":   "foo",
+			"realm": "/test",
+			"exp":   float64(43)}
+		if aud != nil {
+			c["aud"] = aud
+		}
+		return c
+	}
+
+	for _, test := range []struct {
+		allowed   []string
+		aud       interface{}
+		want      string
+		wantError error
+	}{
+		{nil, nil, "", nil},
+		{nil, "other-service", "", nil},
+		{[]string{"my-service"}, nil, "", ErrInvalidClaimAud},
+		{[]string{"my-service"}, 42, "", ErrInvalidClaimAud},
+		{[]string{"my-service"}, []interface{}{"my-service", 42}, "", ErrInvalidClaimAud},
+		{[]string{"my-service"}, "other-service", "", ErrAudienceNotAllowed},
+		{[]string{"my-service"}, []interface{}{}, "", ErrAudienceNotAllowed},
+		{[]string{"my-service"}, []interface{}{"other-service", "another-service"}, "", ErrAudienceNotAllowed},
+		{[]string{"my-service"}, "my-service", "my-service", nil},
+		{[]string{"my-service", "legacy"}, []interface{}{"other-service", "legacy"}, "legacy", nil},
+	} {
+		options.AppSettings.AllowedAudiences = test.allowed
+		ti, err := NewTokenInfo(&jwt.Token{Claims: claims(test.aud)}, time.Unix(42, 0))
+
+		if err != test.wantError {
+			t.Errorf("Unexpected error for audience %v. Wanted %v, got %v", test.aud, test.wantError, err)
+		}
+
+		if err == nil && ti.Audience != test.want {
+			t.Errorf("Unexpected audience for %v. Wanted %q, got %q", test.aud, test.want, ti.Audience)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package jwthandler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	JwtClaimNbf = "nbf"
+	JwtClaimIat = "iat"
+)
+
+var (
+	// ErrTokenExpired should be used when the exp claim is in the past, even with the leeway
+	ErrTokenExpired = errors.New("Token is expired")
+	// ErrTokenNotValidYet should be used when the nbf claim is in the future, even with the leeway
+	ErrTokenNotValidYet = errors.New("Token is not valid yet")
+	// ErrTokenIssuedInFuture should be used when the iat claim is in the future, even with the leeway
+	ErrTokenIssuedInFuture = errors.New("Token is issued in the future")
+	// ErrInvalidClaimNbf should be used whenever the claim nbf is invalid in the JWT
+	ErrInvalidClaimNbf = errors.New("Invalid claim: nbf")
+	// ErrInvalidClaimIat should be used whenever the claim iat is invalid in the JWT
+	ErrInvalidClaimIat = errors.New("Invalid claim: iat")
+
+	// metric names for each of the time based validation failures
+	timeClaimsErrorMetrics = map[error]string{
+		ErrTokenExpired:        "planb.tokeninfo.jwt.errors.expired",
+		ErrTokenNotValidYet:    "planb.tokeninfo.jwt.errors.not_valid_yet",
+		ErrTokenIssuedInFuture: "planb.tokeninfo.jwt.errors.issued_in_future",
+		ErrInvalidClaimExp:     "planb.tokeninfo.jwt.errors.invalid_time_claim",
+		ErrInvalidClaimNbf:     "planb.tokeninfo.jwt.errors.invalid_time_claim",
+		ErrInvalidClaimIat:     "planb.tokeninfo.jwt.errors.invalid_time_claim",
+	}
+)
+
+// validateTimeClaims checks the exp, nbf and iat claims of the token against now, tolerating a clock skew
+// of up to leeway in either direction. The claims are optional but they must be numbers when present
+func validateTimeClaims(t *jwt.Token, now time.Time, leeway time.Duration) error {
+	if exp, has, err := timeClaim(t, JwtClaimExp, ErrInvalidClaimExp); err != nil {
+		return err
+	} else if has && now.After(exp.Add(leeway)) {
+		return ErrTokenExpired
+	}
+
+	if nbf, has, err := timeClaim(t, JwtClaimNbf, ErrInvalidClaimNbf); err != nil {
+		return err
+	} else if has && now.Before(nbf.Add(-leeway)) {
+		return ErrTokenNotValidYet
+	}
+
+	if iat, has, err := timeClaim(t, JwtClaimIat, ErrInvalidClaimIat); err != nil {
+		return err
+	} else if has && now.Before(iat.Add(-leeway)) {
+		return ErrTokenIssuedInFuture
+	}
+
+	return nil
+}
+
+func timeClaim(t *jwt.Token, claim string, invalid error) (time.Time, bool, error) {
+	if _, has := getClaim(t, claim); !has {
+		return time.Time{}, false, nil
+	}
+	v, ok := ClaimAsInt64(t, claim)
+	if !ok {
+		return time.Time{}, true, invalid
+	}
+	return time.Unix(v, 0), true, nil
+}
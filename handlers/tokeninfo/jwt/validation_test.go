@@ -0,0 +1,43 @@
+package jwthandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestValidateTimeClaims(t *testing.T) {
+	now := time.Unix(1000, 0)
+	for _, test := range []struct {
+		claims    jwt.MapClaims
+		leeway    time.Duration
+		wantError error
+	}{
+		{jwt.MapClaims{}, 0, nil},
+		{jwt.MapClaims{"exp": float64(1000), "nbf": float64(1000), "iat": float64(1000)}, 0, nil},
+		{jwt.MapClaims{"exp": float64(999)}, 0, ErrTokenExpired},
+		{jwt.MapClaims{"exp": float64(999)}, time.Second, nil},
+		{jwt.MapClaims{"exp": float64(997)}, 2 * time.Second, ErrTokenExpired},
+		{jwt.MapClaims{"exp": "1001"}, 0, ErrInvalidClaimExp},
+		{jwt.MapClaims{"nbf": float64(1001)}, 0, ErrTokenNotValidYet},
+		{jwt.MapClaims{"nbf": float64(1002)}, 2 * time.Second, nil},
+		{jwt.MapClaims{"nbf": float64(1003)}, 2 * time.Second, ErrTokenNotValidYet},
+		{jwt.MapClaims{"nbf": true}, 0, ErrInvalidClaimNbf},
+		{jwt.MapClaims{"iat": float64(1001)}, 0, ErrTokenIssuedInFuture},
+		{jwt.MapClaims{"iat": float64(1002)}, 2 * time.Second, nil},
+		{jwt.MapClaims{"iat": float64(100000)}, 2 * time.Second, ErrTokenIssuedInFuture},
+		{jwt.MapClaims{"iat": []interface{}{}}, 0, ErrInvalidClaimIat},
+		{jwt.MapClaims{"exp": float64(2000), "iat": float64(1001), "nbf": float64(1001)}, time.Second, nil},
+	} {
+		err := validateTimeClaims(&jwt.Token{Claims: test.claims}, now, test.leeway)
+		if err != test.wantError {
+			t.Errorf("Unexpected error for claims %v with leeway %v. Wanted %v, got %v", test.claims, test.leeway, test.wantError, err)
+		}
+		if err != nil {
+			if _, has := timeClaimsErrorMetrics[err]; !has {
+				t.Errorf("Missing metric for error %v", err)
+			}
+		}
+	}
+}
@@ -1,7 +1,8 @@
 package tokeninfoproxy
 
 import (
-	"bytes"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
@@ -12,6 +13,9 @@ import (
 	"github.com/karlseguin/ccache"
 	"github.com/rcrowley/go-metrics"
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
+	"github.com/zalando/planb-tokeninfo/options"
+	"github.com/zalando/planb-tokeninfo/processor"
+	"github.com/zalando/planb-tokeninfo/revoke"
 )
 
 type tokenInfoProxyHandler struct {
@@ -19,13 +23,24 @@ type tokenInfoProxyHandler struct {
 	cache    *ccache.Cache
 	cacheTTL time.Duration
 	timeout  time.Duration
+	crp      *revoke.CachingRevokeProvider
+}
+
+// cachedTokenInfo is an upstream token info response kept in the cache, with the fields and the issued at time
+// used to check the revocations. Revoked token info is kept without its body, see ServeHTTP
+type cachedTokenInfo struct {
+	body    []byte
+	fields  map[string]interface{}
+	iat     int
+	revoked bool
 }
 
 const proxyCommand = "proxy"
 
 // NewTokenInfoProxyHandler returns an http.Handler that proxies every Request to the server
-// at the upstreamURL
-func NewTokenInfoProxyHandler(upstreamURL *url.URL, cacheMaxSize int64, cacheTTL time.Duration, timeout time.Duration) http.Handler {
+// at the upstreamURL. Tokens and upstream token info responses are checked against the revocations
+// of crp, unless it's nil
+func NewTokenInfoProxyHandler(upstreamURL *url.URL, cacheMaxSize int64, cacheTTL time.Duration, timeout time.Duration, crp *revoke.CachingRevokeProvider) http.Handler {
 	log.Printf("Upstream tokeninfo is %s with %v cache (%d max size)", upstreamURL, cacheTTL, cacheMaxSize)
 	p := httputil.NewSingleHostReverseProxy(upstreamURL)
 	p.Director = hostModifier(upstreamURL, p.Director)
@@ -33,30 +48,7 @@ func NewTokenInfoProxyHandler(upstreamURL *url.URL, cacheMaxSize int64, cacheTTL
 	hystrix.ConfigureCommand(proxyCommand, hystrix.CommandConfig{
 		Timeout: int(timeout.Seconds() * 1000),
 	})
-	return &tokenInfoProxyHandler{upstream: p, cache: cache, cacheTTL: cacheTTL, timeout: timeout}
-}
-
-func newResponseBuffer(w http.ResponseWriter) *responseBuffer {
-	return &responseBuffer{
-		ResponseWriter: w,
-		Buffer:         &bytes.Buffer{},
-	}
-}
-
-type responseBuffer struct {
-	http.ResponseWriter
-	Buffer     *bytes.Buffer
-	StatusCode int
-}
-
-func (rw *responseBuffer) WriteHeader(status int) {
-	rw.StatusCode = status
-	rw.ResponseWriter.WriteHeader(status)
-}
-
-func (rw *responseBuffer) Write(b []byte) (int, error) {
-	rw.Buffer.Write(b)
-	return rw.ResponseWriter.Write(b)
+	return &tokenInfoProxyHandler{upstream: p, cache: cache, cacheTTL: cacheTTL, timeout: timeout, crp: crp}
 }
 
 func incCounter(key string) {
@@ -66,7 +58,7 @@ func incCounter(key string) {
 }
 
 // ServeHTTP proxies the Request with an Access Token to the upstream and sends back the response
-// from the upstream
+// from the upstream. When the Request has Requirements, the upstream token info is checked against them
 func (h *tokenInfoProxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	token := tokeninfo.AccessTokenFromRequest(req)
 	if token == "" {
@@ -74,35 +66,67 @@ func (h *tokenInfoProxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Reque
 		return
 	}
 	start := time.Now()
+	required := tokeninfo.RequirementsFromRequest(req)
+	if h.crp != nil && h.crp.IsTokenRevoked(token) {
+		// revoked tokens are never served from the cache, nor cached again
+		h.cache.Delete(token)
+		incCounter("planb.tokeninfo.proxy.revoked")
+		revoked(w)
+		return
+	}
 	item := h.cache.Get(token)
 	if item != nil {
-		if !item.Expired() {
+		if item.Expired() {
+			incCounter("planb.tokeninfo.proxy.cache.expirations")
+		} else if cached := item.Value().(*cachedTokenInfo); h.isRevoked(cached) {
+			// token info without an iat is only known to be issued before it was cached, so it's kept as revoked
+			// for as long as the revocations are. Asking the upstream again would make it look issued afterwards
+			if !cached.revoked {
+				h.cache.Set(token, &cachedTokenInfo{fields: cached.fields, iat: cached.iat, revoked: true}, options.AppSettings.RevocationCacheTTL)
+				incCounter("planb.tokeninfo.proxy.cache.revoked")
+			}
+			incCounter("planb.tokeninfo.proxy.revoked")
+			revoked(w)
+			return
+		} else if cached.revoked {
+			// the revocation is gone, the upstream decides again
+			h.cache.Delete(token)
+		} else {
 			incCounter("planb.tokeninfo.proxy.cache.hits")
+			if !satisfies(w, required, cached.body) {
+				return
+			}
 			w.Header().Set("Content-Type", "application/json;charset=UTF-8")
 			w.Header().Set("X-Cache", "HIT")
-			w.Write(item.Value().([]byte))
+			w.Write(cached.body)
 			return
-		} else {
-			incCounter("planb.tokeninfo.proxy.cache.expirations")
 		}
 	}
 	incCounter("planb.tokeninfo.proxy.cache.misses")
+	w.Header().Set("X-Cache", "MISS")
+	var (
+		rw     *tokeninfo.BufferedResponse
+		cached *cachedTokenInfo
+	)
 	err := hystrix.Do(proxyCommand, func() error {
 		upstreamStart := time.Now()
-		rw := newResponseBuffer(w)
-		rw.Header().Set("X-Cache", "MISS")
-		h.upstream.ServeHTTP(rw, req)
-		if rw.StatusCode == http.StatusOK && h.cacheTTL > 0 {
-			h.cache.Set(token, rw.Buffer.Bytes(), h.cacheTTL)
+		// the response is buffered so that nothing is written to w after a timeout
+		buf := tokeninfo.NewBufferedResponse()
+		h.upstream.ServeHTTP(buf, req)
+		if buf.StatusCode == http.StatusOK {
+			cached = newCachedTokenInfo(buf.Body.Bytes(), upstreamStart)
+			if h.cacheTTL > 0 && !h.isRevoked(cached) {
+				h.cache.Set(token, cached, h.cacheTTL)
+			}
 		}
 		upstreamTimer := metrics.DefaultRegistry.GetOrRegister("planb.tokeninfo.proxy.upstream", metrics.NewTimer).(metrics.Timer)
 		upstreamTimer.UpdateSince(upstreamStart)
+		rw = buf
 		return nil
 	}, nil)
 
 	if err != nil {
 		status := http.StatusInternalServerError
-		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 		switch err {
 		case hystrix.ErrTimeout:
 			{
@@ -120,19 +144,117 @@ func (h *tokenInfoProxyHandler) ServeHTTP(w http.ResponseWriter, req *http.Reque
 				incCounter("planb.tokeninfo.proxy.upstream.openrequests")
 			}
 		}
-		w.WriteHeader(status)
-		w.Write([]byte(http.StatusText(status)))
+		writeStatus(w, status)
 		return
 	}
 
+	if rw.StatusCode == http.StatusOK && h.isRevoked(cached) {
+		incCounter("planb.tokeninfo.proxy.revoked")
+		revoked(w)
+		return
+	}
+	if rw.StatusCode == http.StatusOK && !satisfies(w, required, rw.Body.Bytes()) {
+		return
+	}
+	for k, v := range rw.HeaderMap {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rw.StatusCode)
+	w.Write(rw.Body.Bytes())
+
 	t := metrics.DefaultRegistry.GetOrRegister("planb.tokeninfo.proxy", metrics.NewTimer).(metrics.Timer)
 	t.UpdateSince(start)
 }
 
+// newCachedTokenInfo keeps the string fields of the upstream token info in body, which was received at the
+// time received. The token info of PlanB has no sub and azp, so they are copied from the uid and the client_id.
+// The issued at time is the iat field, if the upstream sends it, otherwise the time received
+func newCachedTokenInfo(body []byte, received time.Time) *cachedTokenInfo {
+	c := &cachedTokenInfo{body: body, fields: make(map[string]interface{}), iat: int(received.Unix())}
+	var ti map[string]interface{}
+	if err := json.Unmarshal(body, &ti); err != nil {
+		// satisfies reports invalid token info when there are requirements
+		return c
+	}
+	for k, v := range ti {
+		if s, ok := v.(string); ok && s != "" {
+			c.fields[k] = s
+		}
+	}
+	for claim, field := range map[string]string{"sub": "uid", "azp": "client_id"} {
+		if _, ok := c.fields[claim]; !ok && c.fields[field] != nil {
+			c.fields[claim] = c.fields[field]
+		}
+	}
+	if iat, ok := ti["iat"].(float64); ok {
+		c.iat = int(iat)
+	}
+	return c
+}
+
+// isRevoked checks the cached token info against the revocations
+func (h *tokenInfoProxyHandler) isRevoked(c *cachedTokenInfo) bool {
+	return h.crp != nil && c != nil && h.crp.IsTokenInfoRevoked(c.fields, c.iat)
+}
+
+func revoked(w http.ResponseWriter) {
+	e := tokeninfo.ErrInvalidToken.WithReason(tokeninfo.ReasonRevoked)
+	e.Write(w)
+}
+
+// upstreamScopes holds the only fields of the upstream token info needed to check the requirements, so that
+// the other fields, whose types may differ from ours (an "aud" array, for example), are ignored
+type upstreamScopes struct {
+	Scope []string `json:"scope"`
+	Realm string   `json:"realm"`
+}
+
+// satisfies checks the upstream token info in body against the Requirements. If they are not satisfied,
+// the error is written to w and it returns false
+func satisfies(w http.ResponseWriter, required tokeninfo.Requirements, body []byte) bool {
+	if required.Empty() {
+		return true
+	}
+
+	ti := new(upstreamScopes)
+	if err := json.Unmarshal(body, ti); err != nil {
+		log.Println("Failed to parse the upstream token info: ", err)
+		incCounter("planb.tokeninfo.proxy.upstream.invalid")
+		writeStatus(w, http.StatusBadGateway)
+		return false
+	}
+
+	if tie, ok := required.Check(&processor.TokenInfo{Scope: ti.Scope, Realm: ti.Realm}); !ok {
+		incCounter(fmt.Sprintf("planb.tokeninfo.proxy.errors.%s", tie.Error))
+		incCounter(fmt.Sprintf("planb.tokeninfo.proxy.errors.%s.%s", tie.Error, tie.Reason))
+		tie.Write(w)
+		return false
+	}
+	return true
+}
+
+func writeStatus(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
+}
+
 func hostModifier(upstreamURL *url.URL, original func(req *http.Request)) func(req *http.Request) {
 	return func(req *http.Request) {
 		original(req)
 		req.Host = upstreamURL.Host
 		req.URL.Path = upstreamURL.Path
+		// the requirements are checked here, the upstream doesn't need to know about them
+		q := req.URL.Query()
+		stripped := false
+		for k := range q {
+			if tokeninfo.IsRequirementParameter(k) {
+				q.Del(k)
+				stripped = true
+			}
+		}
+		if stripped {
+			req.URL.RawQuery = q.Encode()
+		}
 	}
 }
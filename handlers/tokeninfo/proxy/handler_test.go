@@ -1,12 +1,19 @@
 package tokeninfoproxy
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/zalando/planb-tokeninfo/options"
+	"github.com/zalando/planb-tokeninfo/revoke"
 )
 
 const testTokenInfo = `{"access_token": "xxx","cn": "John Doe","expires_in": 42,"grant_type": "password","realm":"/services","scope":["uid","cn"],"token_type":"Bearer","uid":"jdoe"}` + "\n"
@@ -25,7 +32,7 @@ func TestProxy(t *testing.T) {
 
 	upstream = fmt.Sprintf("http://%s", server.Listener.Addr())
 	url, _ := url.Parse(upstream)
-	h := NewTokenInfoProxyHandler(url, 0, time.Second*0, time.Second*1)
+	h := NewTokenInfoProxyHandler(url, 0, time.Second*0, time.Second*1, nil)
 	invalid := `{"error":"invalid_request","error_description":"Access Token not valid"}` + "\n"
 	for _, it := range []struct {
 		query    string
@@ -70,7 +77,7 @@ func TestHostHeader(t *testing.T) {
 
 	upstream = fmt.Sprintf("http://%s/upstream-tokeninfo", server.Listener.Addr())
 	url, _ := url.Parse(upstream)
-	h := NewTokenInfoProxyHandler(url, 0, time.Second*0, time.Second*1)
+	h := NewTokenInfoProxyHandler(url, 0, time.Second*0, time.Second*1, nil)
 
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token=foo", nil)
@@ -93,7 +100,7 @@ func TestCache(t *testing.T) {
 
 	upstream = fmt.Sprintf("http://%s", server.Listener.Addr())
 	url, _ := url.Parse(upstream)
-	h := NewTokenInfoProxyHandler(url, 10, 1*time.Second, time.Second*1)
+	h := NewTokenInfoProxyHandler(url, 10, 1*time.Second, time.Second*1, nil)
 	for i, it := range []struct {
 		query     string
 		wantCode  int
@@ -145,7 +152,7 @@ func TestCacheDisabled(t *testing.T) {
 
 	upstream = fmt.Sprintf("http://%s", server.Listener.Addr())
 	url, _ := url.Parse(upstream)
-	h := NewTokenInfoProxyHandler(url, 10, 0, time.Second*1)
+	h := NewTokenInfoProxyHandler(url, 10, 0, time.Second*1, nil)
 	for _, it := range []struct {
 		query     string
 		wantCode  int
@@ -187,7 +194,7 @@ func TestUpstreamTimeout(t *testing.T) {
 
 	upstream := fmt.Sprintf("http://%s", server.Listener.Addr())
 	url, _ := url.Parse(upstream)
-	h := NewTokenInfoProxyHandler(url, 0, 0, time.Millisecond*1)
+	h := NewTokenInfoProxyHandler(url, 0, 0, time.Millisecond*1, nil)
 
 	w := httptest.NewRecorder()
 	r, _ := http.NewRequest("GET", "/oauth2/tokeninfo?access_token=foo", nil)
@@ -198,3 +205,175 @@ func TestUpstreamTimeout(t *testing.T) {
 		t.Errorf("Response code should be 504 Gateway Timeout but was %d %s instead", w.Code, http.StatusText(w.Code))
 	}
 }
+
+func TestRequirements(t *testing.T) {
+	var upstreamQuery string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		upstreamQuery = req.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		switch req.URL.Query().Get("access_token") {
+		case "garbage":
+			w.Write([]byte("not json"))
+		case "aud":
+			w.Write([]byte(`{"access_token": "aud","aud":["a","b"],"expires_in": 42,"realm":"/services","scope":["uid"],"uid":"jdoe"}`))
+		default:
+			w.Write([]byte(testTokenInfo))
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	url, _ := url.Parse(fmt.Sprintf("http://%s", server.Listener.Addr()))
+	h := NewTokenInfoProxyHandler(url, 10, time.Minute, time.Second*1, nil)
+	for _, it := range []struct {
+		query     string
+		wantCode  int
+		wantCache string
+	}{
+		{"access_token=foo&required_scope=uid", http.StatusOK, "MISS"},
+		{"access_token=foo&required_scope=uid&required_scope=cn&required_realm=/services", http.StatusOK, "HIT"},
+		{"access_token=foo&required_scope=write", http.StatusForbidden, ""},
+		{"access_token=foo&required_realm=/employees", http.StatusForbidden, ""},
+		{"access_token=bar&required_scope=write", http.StatusForbidden, ""},
+		{"access_token=garbage", http.StatusOK, "MISS"},
+		{"access_token=garbage&required_scope=uid", http.StatusBadGateway, ""},
+		{"access_token=aud&required_scope=uid&required_realm=/services", http.StatusOK, "MISS"},
+		{"access_token=aud&required_scope=write", http.StatusForbidden, ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?"+it.query, nil)
+		h.ServeHTTP(w, r)
+
+		if w.Code != it.wantCode {
+			t.Errorf("Wrong status code for %q. Wanted %d, got %d", it.query, it.wantCode, w.Code)
+		}
+
+		if it.wantCode == http.StatusOK && strings.Contains(it.query, "=foo") && w.Body.String() != testTokenInfo {
+			t.Errorf("Wrong response body for %q: %s", it.query, w.Body.String())
+		}
+
+		if it.wantCode == http.StatusForbidden && !strings.Contains(w.Body.String(), `"insufficient_scope"`) {
+			t.Errorf("Wrong error for %q: %s", it.query, w.Body.String())
+		}
+
+		if it.wantCache != "" && w.Header().Get("X-Cache") != it.wantCache {
+			t.Errorf("Wrong cache header for %q. Wanted %q, got %s", it.query, it.wantCache, w.Header().Get("X-Cache"))
+		}
+
+		if strings.Contains(upstreamQuery, "required_") {
+			t.Errorf("The requirements should not be sent upstream: %s", upstreamQuery)
+		}
+	}
+}
+
+func TestRevocations(t *testing.T) {
+	hash := func(s string) string {
+		h := sha256.Sum256([]byte(options.AppSettings.HashingSalt + s))
+		return base64.URLEncoding.EncodeToString(h[:])
+	}
+
+	var (
+		upstreamCalls int
+		mu            sync.Mutex
+		revocations   string
+	)
+	revokedAt := time.Now().Add(-time.Minute).Unix()
+	iat := time.Now().Add(-time.Hour).Unix()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		if req.URL.Query().Get("access_token") == "old" {
+			fmt.Fprintf(w, `{"uid": "olduser", "client_id": "app", "iat": %d}`, iat)
+			return
+		}
+		w.Write([]byte(testTokenInfo))
+	}))
+	defer upstream.Close()
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `{"revocations": [%s]}`, revocations)
+	}))
+	defer provider.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	pu, _ := url.Parse(provider.URL)
+	crp := revoke.NewCachingRevokeProvider(pu)
+	publish := func(format string, a ...interface{}) {
+		mu.Lock()
+		revocations = fmt.Sprintf(format, a...)
+		mu.Unlock()
+		crp.RefreshRevocations()
+	}
+	h := NewTokenInfoProxyHandler(u, 10, time.Minute, time.Second*1, crp).(*tokenInfoProxyHandler)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?access_token="+token, nil)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, token := range []string{"foo", "foo", "old", "old"} {
+		if w := get(token); w.Code != http.StatusOK {
+			t.Fatalf("Token %q should be valid before the revocations. Got %d", token, w.Code)
+		}
+	}
+	if upstreamCalls != 2 {
+		t.Fatalf("Token info should be cached. Wanted 2 upstream calls, got %d", upstreamCalls)
+	}
+
+	// TOKEN revocations block the token without asking the upstream
+	publish(`{"type": "TOKEN", "revoked_at": %d, "data": {"token_hash": "%s", "issued_before": %d}}`,
+		revokedAt, hash("foo"), revokedAt)
+	for i := 0; i < 2; i++ {
+		if w := get("foo"); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "invalid_token") {
+			t.Errorf("Revoked token should be rejected. Got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if upstreamCalls != 2 || h.cache.Get("foo") != nil {
+		t.Errorf("Revoked token should be removed from the cache without calling the upstream. Upstream calls: %d", upstreamCalls)
+	}
+
+	// SUBJECT revocations are applied to the uid of the token info and its iat
+	publish(`{"type": "SUBJECT", "revoked_at": %d, "data": {"value_hash": "%s", "issued_before": %d}}`,
+		revokedAt, hash("olduser"), revokedAt)
+	calls := upstreamCalls
+	if w := get("old"); w.Code != http.StatusUnauthorized || upstreamCalls != calls {
+		t.Errorf("Revoked token info should be rejected without calling the upstream. Got %d, upstream calls: %d", w.Code, upstreamCalls-calls)
+	}
+	if item := h.cache.Get("old"); item == nil || !item.Value().(*cachedTokenInfo).revoked || item.Value().(*cachedTokenInfo).body != nil {
+		t.Error("Revoked token info should only be kept in the cache as revoked")
+	}
+
+	// without an iat, the token info is only revoked if it was cached before the revocation
+	h.cache.Set("bar", newCachedTokenInfo([]byte(testTokenInfo), time.Unix(iat, 0)), time.Minute)
+	h.cache.Set("baz", newCachedTokenInfo([]byte(`{"uid": "jdoe", "realm": "/employees"}`), time.Unix(iat, 0)), time.Minute)
+	publish(`{"type": "CLAIM", "revoked_at": %d, "data": {"names": ["realm"], "value_hash": "%s", "issued_before": %d}}`,
+		revokedAt+1, hash("/services"), revokedAt)
+	calls = upstreamCalls
+	for i := 0; i < 2; i++ {
+		if w := get("bar"); w.Code != http.StatusUnauthorized || w.Header().Get("X-Cache") != "" {
+			t.Errorf("Token info cached before the revocation should stay revoked. Got %d, X-Cache %q", w.Code, w.Header().Get("X-Cache"))
+		}
+	}
+	if w := get("new"); w.Code != http.StatusOK || w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Token info first received after the revocation should be accepted. Got %d, X-Cache %q", w.Code, w.Header().Get("X-Cache"))
+	}
+	if w := get("new"); w.Code != http.StatusOK || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Token info received after the revocation should be cached. Got %d, X-Cache %q", w.Code, w.Header().Get("X-Cache"))
+	}
+
+	// GLOBAL revocations purge and block the token info cached before them
+	publish(`{"type": "GLOBAL", "revoked_at": %d, "data": {"issued_before": %d}}`, revokedAt+2, revokedAt)
+	for i := 0; i < 2; i++ {
+		if w := get("baz"); w.Code != http.StatusUnauthorized {
+			t.Errorf("Token info cached before the GLOBAL revocation should stay revoked when requested again. Got %d", w.Code)
+		}
+	}
+	if upstreamCalls != calls+1 {
+		t.Errorf("Revoked token info should not be requested from the upstream again. Wanted %d upstream calls, got %d", calls+1, upstreamCalls)
+	}
+}
@@ -0,0 +1,65 @@
+package tokeninfo
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zalando/planb-tokeninfo/processor"
+)
+
+const (
+	requiredScopeParameter = "required_scope"
+	requiredRealmParameter = "required_realm"
+)
+
+// Requirements are the scopes and the realm that a valid token must have to be accepted
+type Requirements struct {
+	Scopes []string
+	Realm  string
+}
+
+// RequirementsFromRequest returns the Requirements from the optional required_scope and required_realm
+// parameters of the Request. The required_scope parameter can be repeated or contain a space separated
+// list of scopes
+func RequirementsFromRequest(req *http.Request) Requirements {
+	r := Requirements{Realm: req.FormValue(requiredRealmParameter)}
+	for _, v := range req.Form[requiredScopeParameter] {
+		r.Scopes = append(r.Scopes, strings.Fields(v)...)
+	}
+	return r
+}
+
+// IsRequirementParameter returns true if the query parameter name is one of the Requirements parameters
+func IsRequirementParameter(name string) bool {
+	return name == requiredScopeParameter || name == requiredRealmParameter
+}
+
+// Empty returns true when there's nothing required
+func (r Requirements) Empty() bool {
+	return len(r.Scopes) == 0 && r.Realm == ""
+}
+
+// Check verifies that the TokenInfo ti has all the required scopes and the required realm. It returns
+// false and an ErrInsufficientScope when it doesn't. Realms are compared regardless of the leading slash
+func (r Requirements) Check(ti *processor.TokenInfo) (Error, bool) {
+	if r.Realm != "" && strings.TrimPrefix(r.Realm, "/") != strings.TrimPrefix(ti.Realm, "/") {
+		return r.insufficientScope(ReasonRealmMismatch), false
+	}
+
+	granted := make(map[string]bool, len(ti.Scope))
+	for _, s := range ti.Scope {
+		granted[s] = true
+	}
+	for _, s := range r.Scopes {
+		if !granted[s] {
+			return r.insufficientScope(ReasonMissingScope), false
+		}
+	}
+	return Error{}, true
+}
+
+func (r Requirements) insufficientScope(reason string) Error {
+	e := ErrInsufficientScope.WithReason(reason)
+	e.scope = strings.Join(r.Scopes, " ")
+	return e
+}
@@ -0,0 +1,72 @@
+package tokeninfo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zalando/planb-tokeninfo/processor"
+)
+
+func TestRequirementsFromRequest(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  Requirements
+	}{
+		{"", Requirements{}},
+		{"access_token=foo", Requirements{}},
+		{"required_scope=uid", Requirements{Scopes: []string{"uid"}}},
+		{"required_scope=uid&required_scope=cn", Requirements{Scopes: []string{"uid", "cn"}}},
+		{"required_scope=uid+cn&required_realm=/services", Requirements{Scopes: []string{"uid", "cn"}, Realm: "/services"}},
+		{"required_realm=/employees", Requirements{Realm: "/employees"}},
+	} {
+		req, _ := http.NewRequest("GET", "http://example.com/oauth2/tokeninfo?"+test.query, nil)
+		r := RequirementsFromRequest(req)
+		if !reflect.DeepEqual(r, test.want) {
+			t.Errorf("Wrong requirements for %q. Wanted %+v, got %+v", test.query, test.want, r)
+		}
+		if r.Empty() != (len(test.want.Scopes) == 0 && test.want.Realm == "") {
+			t.Errorf("Wrong result of Empty() for %q", test.query)
+		}
+	}
+}
+
+func TestRequirementsCheck(t *testing.T) {
+	ti := &processor.TokenInfo{Scope: []string{"uid", "cn"}, Realm: "/services"}
+	for _, test := range []struct {
+		given      Requirements
+		wantOk     bool
+		wantReason string
+	}{
+		{Requirements{}, true, ""},
+		{Requirements{Scopes: []string{"uid"}}, true, ""},
+		{Requirements{Scopes: []string{"uid", "cn"}, Realm: "/services"}, true, ""},
+		{Requirements{Realm: "services"}, true, ""},
+		{Requirements{Scopes: []string{"uid", "write"}}, false, ReasonMissingScope},
+		{Requirements{Realm: "/employees"}, false, ReasonRealmMismatch},
+	} {
+		e, ok := test.given.Check(ti)
+		if ok != test.wantOk {
+			t.Errorf("Wrong check result for %+v. Wanted %t, got %t", test.given, test.wantOk, ok)
+		}
+		if e.Reason != test.wantReason {
+			t.Errorf("Wrong reason for %+v. Wanted %q, got %q", test.given, test.wantReason, e.Reason)
+		}
+	}
+}
+
+func TestInsufficientScopeChallenge(t *testing.T) {
+	e, _ := Requirements{Scopes: []string{"uid", "write"}}.Check(&processor.TokenInfo{Scope: []string{"uid"}})
+	w := httptest.NewRecorder()
+	e.Write(w)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Wrong status code. Wanted %d, got %d", http.StatusForbidden, w.Code)
+	}
+
+	want := `Bearer error="insufficient_scope", error_description="Access Token has insufficient privileges", scope="uid write"`
+	if h := w.Header().Get("WWW-Authenticate"); h != want {
+		t.Errorf("Wrong WWW-Authenticate header. Wanted %q, got %q", want, h)
+	}
+}
@@ -0,0 +1,49 @@
+package tokeninfo
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// BufferedResponse is an http.ResponseWriter that keeps the whole response in memory
+type BufferedResponse struct {
+	HeaderMap  http.Header
+	Body       *bytes.Buffer
+	StatusCode int
+}
+
+// NewBufferedResponse returns an empty BufferedResponse with the status code 200 OK
+func NewBufferedResponse() *BufferedResponse {
+	return &BufferedResponse{HeaderMap: make(http.Header), Body: new(bytes.Buffer), StatusCode: http.StatusOK}
+}
+
+// Header returns the response headers
+func (rw *BufferedResponse) Header() http.Header {
+	return rw.HeaderMap
+}
+
+// WriteHeader records the status code
+func (rw *BufferedResponse) WriteHeader(status int) {
+	rw.StatusCode = status
+}
+
+// Write appends b to the response body
+func (rw *BufferedResponse) Write(b []byte) (int, error) {
+	return rw.Body.Write(b)
+}
+
+// ServeToken runs the access token through the http.Handler h as if it was sent in a regular tokeninfo
+// request and returns the buffered response. The parent Request is used for its context and remote address
+func ServeToken(h http.Handler, parent *http.Request, token string) (*BufferedResponse, error) {
+	r, err := http.NewRequest(http.MethodGet, "/oauth2/tokeninfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(parent.Context())
+	r.RemoteAddr = parent.RemoteAddr
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	rw := NewBufferedResponse()
+	h.ServeHTTP(rw, r)
+	return rw, nil
+}
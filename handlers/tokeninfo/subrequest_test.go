@@ -0,0 +1,36 @@
+package tokeninfo
+
+import (
+	"net/http"
+	"testing"
+)
+
+type echoHandler struct{}
+
+func (h *echoHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("X-Path", req.URL.Path)
+	w.WriteHeader(http.StatusTeapot)
+	w.Write([]byte(AccessTokenFromRequest(req)))
+}
+
+func TestServeToken(t *testing.T) {
+	parent, _ := http.NewRequest("POST", "http://example.com/oauth2/introspect", nil)
+	parent.RemoteAddr = "10.0.0.1:1234"
+
+	rw, err := ServeToken(&echoHandler{}, parent, "foo")
+	if err != nil {
+		t.Fatal("Failed to serve token: ", err)
+	}
+
+	if rw.StatusCode != http.StatusTeapot {
+		t.Errorf("Wrong status code. Wanted %d, got %d", http.StatusTeapot, rw.StatusCode)
+	}
+
+	if rw.Body.String() != "foo" {
+		t.Errorf("Wrong access token in the request. Wanted %q, got %q", "foo", rw.Body.String())
+	}
+
+	if rw.Header().Get("X-Path") != "/oauth2/tokeninfo" {
+		t.Errorf("Wrong request path %q", rw.Header().Get("X-Path"))
+	}
+}
@@ -0,0 +1,92 @@
+package keyloader
+
+import (
+	"fmt"
+
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+)
+
+// chainLoader looks up keys in several loaders, in order
+type chainLoader struct {
+	loaders []JWKLoader
+}
+
+// NewChainLoader returns a JWKLoader that looks up keys in each of the loaders, in the given order, and returns
+// the first key found. ErrIssuerMismatch is only returned if none of the loaders has the key for the issuer
+func NewChainLoader(loaders ...JWKLoader) JWKLoader {
+	return &chainLoader{loaders: loaders}
+}
+
+func (c *chainLoader) LoadKey(id string) (interface{}, error) {
+	for _, kl := range c.loaders {
+		if k, err := kl.LoadKey(id); err == nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("Key '%s' not found", id)
+}
+
+// Keys returns the keys from all the loaders, named by KeyName. For duplicate names, the key of the first
+// loader is returned
+func (c *chainLoader) Keys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	for i := len(c.loaders) - 1; i >= 0; i-- {
+		for name, k := range c.loaders[i].Keys() {
+			keys[name] = k
+		}
+	}
+	return keys
+}
+
+// PublishedKeys returns the published keys of the loaders that are a KeyPublisher. If there are none, it
+// returns the keys from all the loaders
+func (c *chainLoader) PublishedKeys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	publishers := false
+	for i := len(c.loaders) - 1; i >= 0; i-- {
+		if p, ok := c.loaders[i].(KeyPublisher); ok {
+			publishers = true
+			for name, k := range p.PublishedKeys() {
+				keys[name] = k
+			}
+		}
+	}
+	if !publishers {
+		return c.Keys()
+	}
+	return keys
+}
+
+func (c *chainLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	k, err := c.LoadIssuerJWK(issuer, id)
+	if err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+func (c *chainLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	mismatch := false
+	for _, kl := range c.loaders {
+		k, err := kl.LoadIssuerJWK(issuer, id)
+		if err == nil {
+			return k, nil
+		}
+		if err == ErrIssuerMismatch {
+			mismatch = true
+		}
+	}
+	if mismatch {
+		return jwk.JSONWebKey{}, ErrIssuerMismatch
+	}
+	return jwk.JSONWebKey{}, fmt.Errorf("Key '%s' not found", id)
+}
+
+// Issuers returns the issuers of all the loaders
+func (c *chainLoader) Issuers() []string {
+	var issuers []string
+	for _, kl := range c.loaders {
+		issuers = append(issuers, kl.Issuers()...)
+	}
+	return issuers
+}
@@ -0,0 +1,117 @@
+package keyloader
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+)
+
+type mockLoader struct {
+	issuer string
+	keys   map[string]interface{}
+}
+
+func (m *mockLoader) LoadKey(id string) (interface{}, error) {
+	if k, has := m.keys[id]; has {
+		return k, nil
+	}
+	return nil, fmt.Errorf("Key '%s' not found", id)
+}
+
+func (m *mockLoader) Keys() map[string]interface{} { return m.keys }
+func (m *mockLoader) Issuers() []string            { return []string{m.issuer} }
+
+func (m *mockLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	k, err := m.LoadIssuerJWK(issuer, id)
+	return k.Key, err
+}
+
+func (m *mockLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	k, has := m.keys[id]
+	if !has {
+		return jwk.JSONWebKey{}, fmt.Errorf("Key '%s' not found", id)
+	}
+	if issuer != m.issuer {
+		return jwk.JSONWebKey{}, ErrIssuerMismatch
+	}
+	return jwk.JSONWebKey{KeyID: id, Key: k}, nil
+}
+
+func TestChainLoader(t *testing.T) {
+	first := &mockLoader{issuer: "static", keys: map[string]interface{}{"a": "static-a", "b": "static-b"}}
+	second := &mockLoader{issuer: "openid", keys: map[string]interface{}{"b": "openid-b", "c": "openid-c"}}
+	kl := NewChainLoader(first, second)
+
+	for _, test := range []struct {
+		issuer  string
+		id      string
+		want    interface{}
+		wantErr error
+	}{
+		{"static", "a", "static-a", nil},
+		{"openid", "b", "openid-b", nil},
+		{"static", "b", "static-b", nil},
+		{"openid", "a", nil, ErrIssuerMismatch},
+		{"static", "c", nil, ErrIssuerMismatch},
+	} {
+		k, err := kl.LoadIssuerKey(test.issuer, test.id)
+		if k != test.want || err != test.wantErr {
+			t.Errorf("Unexpected key %q of %q: %v, %v", test.id, test.issuer, k, err)
+		}
+	}
+
+	if _, err := kl.LoadIssuerKey("static", "missing"); err == nil || err == ErrIssuerMismatch {
+		t.Error("Missing keys should not be found: ", err)
+	}
+
+	if k, err := kl.LoadKey("b"); err != nil || k != "static-b" {
+		t.Errorf("LoadKey should return the key of the first loader. Got %v, %v", k, err)
+	}
+
+	keys := kl.Keys()
+	if len(keys) != 3 || keys["b"] != "static-b" {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+
+	if issuers := kl.Issuers(); len(issuers) != 2 {
+		t.Errorf("Unexpected issuers %v", issuers)
+	}
+
+	if keys := kl.(KeyPublisher).PublishedKeys(); len(keys) != 3 {
+		t.Errorf("Without publishers all the keys should be published. Got %v", keys)
+	}
+}
+
+type mockPublisher struct {
+	mockLoader
+	published map[string]interface{}
+}
+
+func (m *mockPublisher) PublishedKeys() map[string]interface{} { return m.published }
+
+func TestChainLoaderPublishedKeys(t *testing.T) {
+	static := &mockLoader{issuer: "static", keys: map[string]interface{}{"static/a": "static-a"}}
+	openid := &mockPublisher{
+		mockLoader: mockLoader{issuer: "openid", keys: map[string]interface{}{"openid/b": "openid-b", "other/c": "other-c"}},
+		published:  map[string]interface{}{"openid/b": "openid-b"},
+	}
+	kl := NewChainLoader(static, openid)
+
+	if keys := kl.Keys(); len(keys) != 3 {
+		t.Errorf("Unexpected keys %v", keys)
+	}
+	keys := kl.(KeyPublisher).PublishedKeys()
+	if len(keys) != 1 || keys["openid/b"] != "openid-b" {
+		t.Errorf("Only the published keys of the publishers should be returned. Got %v", keys)
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	if n := KeyName("", "kid"); n != "kid" {
+		t.Errorf("Keys without an issuer should use the key id. Got %q", n)
+	}
+	if n := KeyName("PlanB", "kid"); n != "PlanB/kid" {
+		t.Errorf("Keys with an issuer should be prefixed with it. Got %q", n)
+	}
+}
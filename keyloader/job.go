@@ -14,3 +14,17 @@ func Schedule(interval time.Duration, job JobFunc) {
 		}
 	}()
 }
+
+// IntervalFunc is a type that defines a function returning the interval until the next execution of a job
+type IntervalFunc func() time.Duration
+
+// ScheduleWithInterval executes the job in intervals that are returned by next after every execution. The
+// task is left running in the background
+func ScheduleWithInterval(next IntervalFunc, job JobFunc) {
+	go func() {
+		for {
+			job()
+			time.Sleep(next())
+		}
+	}()
+}
@@ -1,6 +1,7 @@
 package keyloader
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -13,3 +14,15 @@ func TestScheduling(t *testing.T) {
 		t.Error("Job is not being executed")
 	}
 }
+
+func TestSchedulingWithInterval(t *testing.T) {
+	var c, n int32
+	ScheduleWithInterval(func() time.Duration {
+		atomic.AddInt32(&n, 1)
+		return time.Millisecond
+	}, func() { atomic.AddInt32(&c, 1) })
+	time.Sleep(time.Millisecond * 5)
+	if atomic.LoadInt32(&c) < 2 || atomic.LoadInt32(&n) == 0 {
+		t.Error("Job is not being executed in the returned intervals")
+	}
+}
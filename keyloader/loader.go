@@ -1,8 +1,49 @@
 package keyloader
 
+import (
+	"errors"
+
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+)
+
+// ErrIssuerMismatch should be used when a key was found but it belongs to a different issuer
+var ErrIssuerMismatch = errors.New("Key does not belong to the token issuer")
+
 // A KeyLoader fetches cryptographic keys and is able to lookup them up by ID or return the entire
 // map of known keys
 type KeyLoader interface {
 	LoadKey(id string) (interface{}, error)
 	Keys() map[string]interface{}
 }
+
+// A KeyPublisher is a KeyLoader that also uses keys of other issuers. PublishedKeys returns only the keys of
+// the main issuer, the ones that can be published as its own
+type KeyPublisher interface {
+	KeyLoader
+	PublishedKeys() map[string]interface{}
+}
+
+// An IssuerKeyLoader is a KeyLoader that knows the issuers of its keys. Keys can be looked up by
+// the issuer together with the key ID, so that different issuers can use the same key IDs.
+// LoadIssuerKey returns ErrIssuerMismatch when the key exists but belongs to another issuer
+type IssuerKeyLoader interface {
+	KeyLoader
+	LoadIssuerKey(issuer string, id string) (interface{}, error)
+	Issuers() []string
+}
+
+// A JWKLoader is an IssuerKeyLoader that also returns the algorithm and the use the keys were published
+// for, so that they can be bound to the signing method of the tokens
+type JWKLoader interface {
+	IssuerKeyLoader
+	LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error)
+}
+
+// KeyName returns the name of the key with the id in the maps returned by Keys. Keys of known issuers are
+// prefixed with the issuer, so that the same key ID can be used by different issuers
+func KeyName(issuer string, id string) string {
+	if issuer == "" {
+		return id
+	}
+	return issuer + "/" + id
+}
@@ -0,0 +1,133 @@
+package openid
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/breaker"
+	"github.com/zalando/planb-tokeninfo/ht"
+)
+
+// cachedResource remembers the body and the validators of the last response of an HTTP resource, so that
+// it can be fetched with conditional requests and a 304 Not Modified response can reuse the previous body
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc7232
+type cachedResource struct {
+	mu           sync.Mutex
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+	maxAge       time.Duration
+	hasMaxAge    bool
+}
+
+// fetch gets the resource from the url with a circuit breaker named name. It returns the body and whether it
+// was modified since the last fetch. The validators are only sent if the url didn't change. Every fetch is
+// counted as planb.openidprovider.<metric>.ok, .notmodified or .failed
+func (r *cachedResource) fetch(name string, metric string, url string) ([]byte, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		incCounter(fmt.Sprintf("planb.openidprovider.%s.failed", metric))
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", ht.UserAgent)
+	cached := r.body != nil && r.url == url
+	if cached {
+		if r.etag != "" {
+			req.Header.Set("If-None-Match", r.etag)
+		}
+		if r.lastModified != "" {
+			req.Header.Set("If-Modified-Since", r.lastModified)
+		}
+	}
+
+	resp, err := breaker.Do(name, req)
+	if err != nil {
+		incCounter(fmt.Sprintf("planb.openidprovider.%s.failed", metric))
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		r.maxAge, r.hasMaxAge = maxAge(resp.Header)
+		incCounter(fmt.Sprintf("planb.openidprovider.%s.notmodified", metric))
+		return r.body, false, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			incCounter(fmt.Sprintf("planb.openidprovider.%s.failed", metric))
+			return nil, false, err
+		}
+		r.url = url
+		r.etag = resp.Header.Get("ETag")
+		r.lastModified = resp.Header.Get("Last-Modified")
+		r.body = body
+		r.maxAge, r.hasMaxAge = maxAge(resp.Header)
+		incCounter(fmt.Sprintf("planb.openidprovider.%s.ok", metric))
+		return body, true, nil
+	default:
+		incCounter(fmt.Sprintf("planb.openidprovider.%s.failed", metric))
+		return nil, false, errInvalidResponseStatusCode
+	}
+}
+
+// invalidate forgets the last response, so that the next fetch downloads the whole resource again. It
+// should be used when the body of the last response could not be used
+func (r *cachedResource) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.body = nil
+	r.etag = ""
+	r.lastModified = ""
+}
+
+// freshness returns the max-age of the last response, if it had one
+func (r *cachedResource) freshness() (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxAge, r.hasMaxAge
+}
+
+// maxAge returns the freshness lifetime from the max-age directive of the Cache-Control header, minus the
+// Age of the response. Responses with no-cache or no-store have a zero lifetime
+func maxAge(h http.Header) (time.Duration, bool) {
+	var (
+		lifetime time.Duration
+		found    bool
+	)
+	for _, d := range strings.Split(strings.Join(h["Cache-Control"], ","), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-cache" || d == "no-store":
+			return 0, true
+		case strings.HasPrefix(d, "max-age="):
+			s, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(d, "max-age="), `"`))
+			if err != nil || s < 0 {
+				continue
+			}
+			lifetime = time.Duration(s) * time.Second
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	return lifetime, true
+}
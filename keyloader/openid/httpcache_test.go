@@ -0,0 +1,110 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/caching"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestMaxAge(t *testing.T) {
+	for _, test := range []struct {
+		cacheControl string
+		age          string
+		want         time.Duration
+		wantOk       bool
+	}{
+		{"", "", 0, false},
+		{"public", "", 0, false},
+		{"public, max-age=60", "", time.Minute, true},
+		{"Max-Age=\"60\"", "", time.Minute, true},
+		{"max-age=60", "15", 45 * time.Second, true},
+		{"max-age=60", "120", 0, true},
+		{"max-age=foo", "", 0, false},
+		{"max-age=60, no-cache", "", 0, true},
+		{"no-store", "", 0, true},
+	} {
+		h := http.Header{}
+		if test.cacheControl != "" {
+			h.Set("Cache-Control", test.cacheControl)
+		}
+		if test.age != "" {
+			h.Set("Age", test.age)
+		}
+		got, ok := maxAge(h)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("Wrong max-age for %q. Wanted %v, %v, got %v, %v", test.cacheControl, test.want, test.wantOk, got, ok)
+		}
+	}
+}
+
+func TestConditionalRefresh(t *testing.T) {
+	var (
+		listener string
+		parsed   int
+	)
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			if req.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		parsed++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"keys": [{"kid": "testkey", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}]}`)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	listener = server.URL
+
+	count := func(name string) int64 {
+		return metrics.GetOrRegisterCounter(name, metrics.DefaultRegistry).Count()
+	}
+	ok, notModified := count("planb.openidprovider.jwks.ok"), count("planb.openidprovider.jwks.notmodified")
+
+	kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache(), refreshInterval: time.Minute}
+	if d := kl.nextRefresh(); d != time.Minute {
+		t.Errorf("Without a max-age the refresh interval should be used. Wanted %v, got %v", time.Minute, d)
+	}
+
+	kl.refreshKeys()
+	kl.refreshKeys()
+
+	if parsed != 1 {
+		t.Errorf("Unmodified JWKS should not be downloaded again. Wanted 1 download, got %d", parsed)
+	}
+	if _, err := kl.LoadKey("testkey"); err != nil {
+		t.Error("Key `testkey` should still be loaded: ", err)
+	}
+	if got := count("planb.openidprovider.jwks.ok") - ok; got != 1 {
+		t.Errorf("Wrong number of JWKS 200 responses. Wanted 1, got %d", got)
+	}
+	if got := count("planb.openidprovider.jwks.notmodified") - notModified; got != 1 {
+		t.Errorf("Wrong number of JWKS 304 responses. Wanted 1, got %d", got)
+	}
+
+	if d := kl.nextRefresh(); d != options.AppSettings.OpenIDProviderMaxRefreshInterval {
+		t.Errorf("The max-age should be limited to the maximum refresh interval. Wanted %v, got %v", options.AppSettings.OpenIDProviderMaxRefreshInterval, d)
+	}
+
+	kl.keysResource.invalidate()
+	kl.refreshKeys()
+	if parsed != 2 {
+		t.Errorf("Invalidated JWKS should be downloaded again. Wanted 2 downloads, got %d", parsed)
+	}
+}
@@ -32,6 +32,12 @@ func (b *base64Bytes) toBigInt() *big.Int {
 	return new(big.Int).SetBytes([]byte(*b))
 }
 
+// toInt returns the value as an int or 0 if it doesn't fit into 31 bits, instead of silently
+// truncating it. No valid key uses a zero value
 func (b *base64Bytes) toInt() int {
-	return int(b.toBigInt().Int64())
+	i := b.toBigInt()
+	if i.BitLen() > 31 {
+		return 0
+	}
+	return int(i.Int64())
 }
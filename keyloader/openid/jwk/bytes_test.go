@@ -18,6 +18,7 @@ func TestBytes(t *testing.T) {
 		{`"A"`, nil, nil, 0, true},
 		{`""`, nil, nil, 0, false},
 		{`"CBU"`, &base64Bytes{0x08, 0x15}, big.NewInt(2069), 2069, false},
+		{`"AQAAAAE"`, &base64Bytes{0x01, 0x00, 0x00, 0x00, 0x01}, big.NewInt(4294967297), 0, false},
 	} {
 		var got *base64Bytes
 		if test.want != nil {
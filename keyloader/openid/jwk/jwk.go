@@ -2,8 +2,10 @@ package jwk
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,12 +17,19 @@ type JSONWebKeySet struct {
 	Keys []JSONWebKey `json:"keys"`
 }
 
-// The JSONWebKey is a type that holds keys obtained from a JWKS endpoint
+// The JSONWebKey is a type that holds keys obtained from a JWKS endpoint. The Certificates are the
+// optional x5c chain, starting with the certificate of the Key
 type JSONWebKey struct {
-	Key       interface{}
-	KeyID     string
-	Algorithm string
-	Use       string
+	Key                         interface{}
+	KeyID                       string
+	Algorithm                   string
+	Use                         string
+	Certificates                []*x509.Certificate
+	CertificateThumbprintSHA1   []byte
+	CertificateThumbprintSHA256 []byte
+
+	// the error parsing the x5c chain, reported by VerifyCertificates
+	certificatesErr error
 }
 
 type jsonWebKeyHelper struct {
@@ -34,6 +43,12 @@ type jsonWebKeyHelper struct {
 	Y   *base64Bytes `json:"y,omitempty"`
 	N   *base64Bytes `json:"n,omitempty"`
 	E   *base64Bytes `json:"e,omitempty"`
+
+	X5c     []string     `json:"x5c,omitempty"`
+	X5t     *base64Bytes `json:"x5t,omitempty"`
+	X5tS256 *base64Bytes `json:"x5t#S256,omitempty"`
+
+	certs []*x509.Certificate
 }
 
 var (
@@ -41,6 +56,8 @@ var (
 	ErrInvalidRSAPublicKey = errors.New("Invalid RSA Public key")
 	// ErrInvalidECDSAPublicKey should be used whenever the key thumbprint is an invalid ECDSA key
 	ErrInvalidECDSAPublicKey = errors.New("Invalid ECDSA Public key")
+	// ErrInvalidEd25519PublicKey should be used whenever the key thumbprint is an invalid Ed25519 key
+	ErrInvalidEd25519PublicKey = errors.New("Invalid Ed25519 Public key")
 )
 
 // ToMap returns the JSON Web Keys Set as a simple map with the Key IDs as keys of the map and the
@@ -60,6 +77,9 @@ func (jwks *JSONWebKeySet) ToMap() map[string]interface{} {
 
 func (key *jsonWebKeyHelper) toRSA() (*rsa.PublicKey, error) {
 	if key.N == nil || key.E == nil {
+		if pub, ok := key.certificateKey().(*rsa.PublicKey); ok {
+			return pub, nil
+		}
 		return nil, ErrInvalidRSAPublicKey
 	}
 
@@ -83,6 +103,9 @@ func (key *jsonWebKeyHelper) toECDSA() (*ecdsa.PublicKey, error) {
 	}
 
 	if key.X == nil || key.Y == nil {
+		if pub, ok := key.certificateKey().(*ecdsa.PublicKey); ok && pub.Curve == curve {
+			return pub, nil
+		}
 		return nil, ErrInvalidECDSAPublicKey
 	}
 
@@ -93,25 +116,59 @@ func (key *jsonWebKeyHelper) toECDSA() (*ecdsa.PublicKey, error) {
 	}, nil
 }
 
+func (key *jsonWebKeyHelper) toEd25519() (ed25519.PublicKey, error) {
+	if key.Crv != "Ed25519" {
+		return nil, fmt.Errorf("Unsupported OKP curve '%s'", key.Crv)
+	}
+
+	if key.X == nil {
+		if pub, ok := key.certificateKey().(ed25519.PublicKey); ok {
+			return pub, nil
+		}
+		return nil, ErrInvalidEd25519PublicKey
+	}
+
+	if len(*key.X) != ed25519.PublicKeySize {
+		return nil, ErrInvalidEd25519PublicKey
+	}
+
+	return ed25519.PublicKey(*key.X), nil
+}
+
 // UnmarshalJSON is used to unmarshal a JWK entry from the JSON Web Keys Set
-// It assumes all keys from that endpoint are public keys. Only RSA and ECDSA keys are supported
+// It assumes all keys from that endpoint are public keys. Only RSA, ECDSA and Ed25519 (OKP) keys are supported.
+// Without the public key parameters, the key is taken from the first certificate of the x5c chain. Invalid
+// certificates and thumbprints don't fail the whole set, they are reported by VerifyCertificates for this key only
 func (jwk *JSONWebKey) UnmarshalJSON(data []byte) (err error) {
 	var buf jsonWebKeyHelper
 	if err = json.Unmarshal(data, &buf); err != nil {
 		return err
 	}
+	certs, certificatesErr := parseCertificates(buf.X5c)
+	buf.certs = certs
 	var key interface{}
 	switch buf.Kty {
 	case "EC":
 		key, err = buf.toECDSA()
 	case "RSA":
 		key, err = buf.toRSA()
+	case "OKP":
+		key, err = buf.toEd25519()
 	default:
 		err = fmt.Errorf("Unsupported key type %q", buf.Kty)
 	}
 
-	if err == nil {
-		*jwk = JSONWebKey{Key: key, KeyID: buf.Kid, Algorithm: buf.Alg, Use: buf.Use}
+	if err != nil {
+		return err
+	}
+
+	k := JSONWebKey{Key: key, KeyID: buf.Kid, Algorithm: buf.Alg, Use: buf.Use, Certificates: buf.certs, certificatesErr: certificatesErr}
+	if buf.X5t != nil {
+		k.CertificateThumbprintSHA1 = []byte(*buf.X5t)
+	}
+	if buf.X5tS256 != nil {
+		k.CertificateThumbprintSHA256 = []byte(*buf.X5tS256)
 	}
-	return
+	*jwk = k
+	return nil
 }
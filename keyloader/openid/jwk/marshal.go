@@ -0,0 +1,47 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+func (b base64Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// MarshalJSON encodes the key as a JSON Web Key that UnmarshalJSON reads back, including its x5c chain
+// and thumbprints. It's used to persist the keys that were accepted
+func (jwk JSONWebKey) MarshalJSON() ([]byte, error) {
+	buf := jsonWebKeyHelper{Use: jwk.Use, Kid: jwk.KeyID, Alg: jwk.Algorithm}
+	switch key := jwk.Key.(type) {
+	case *rsa.PublicKey:
+		n, e := base64Bytes(key.N.Bytes()), base64Bytes(big.NewInt(int64(key.E)).Bytes())
+		buf.Kty, buf.N, buf.E = "RSA", &n, &e
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		x, y := base64Bytes(padded(key.X, size)), base64Bytes(padded(key.Y, size))
+		buf.Kty, buf.Crv, buf.X, buf.Y = "EC", key.Curve.Params().Name, &x, &y
+	case ed25519.PublicKey:
+		x := base64Bytes(key)
+		buf.Kty, buf.Crv, buf.X = "OKP", "Ed25519", &x
+	default:
+		return nil, fmt.Errorf("Unsupported key type %T", jwk.Key)
+	}
+	for _, c := range jwk.Certificates {
+		buf.X5c = append(buf.X5c, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+	if jwk.CertificateThumbprintSHA1 != nil {
+		x5t := base64Bytes(jwk.CertificateThumbprintSHA1)
+		buf.X5t = &x5t
+	}
+	if jwk.CertificateThumbprintSHA256 != nil {
+		x5tS256 := base64Bytes(jwk.CertificateThumbprintSHA256)
+		buf.X5tS256 = &x5tS256
+	}
+	return json.Marshal(buf)
+}
@@ -0,0 +1,57 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	cert := newTestCertificate(t, &ecKey.PublicKey, nil, ecKey, time.Now().Add(time.Hour))
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+
+	for _, key := range []JSONWebKey{
+		{Key: &rsaKey.PublicKey, KeyID: "rsa", Algorithm: "RS256", Use: "sig"},
+		{Key: &ecKey.PublicKey, KeyID: "ec"},
+		{Key: ed25519.PublicKey(testEd25519X), KeyID: "okp", Algorithm: "EdDSA"},
+		{
+			Key:                         &ecKey.PublicKey,
+			KeyID:                       "x5c",
+			Algorithm:                   "ES384",
+			Use:                         "sig",
+			Certificates:                []*x509.Certificate{cert},
+			CertificateThumbprintSHA1:   sha1Sum[:],
+			CertificateThumbprintSHA256: sha256Sum[:],
+		},
+	} {
+		b, err := json.Marshal(key)
+		if err != nil {
+			t.Errorf("Failed to marshal key %q: %v", key.KeyID, err)
+			continue
+		}
+		var got JSONWebKey
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Errorf("Failed to unmarshal key %q from %s: %v", key.KeyID, b, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, key) {
+			t.Errorf("Key %q changed when marshalled. Wanted %v, got %v", key.KeyID, key, got)
+		}
+	}
+
+	if _, err := json.Marshal(JSONWebKey{Key: "foo", KeyID: "foo"}); err == nil {
+		t.Error("Unsupported key types should fail to marshal")
+	}
+}
@@ -0,0 +1,48 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// Thumbprint returns the base64url encoded SHA-256 thumbprint of the public key. It only depends on the
+// key material, so it can be used to tell whether two keys are the same regardless of their other parameters
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc7638
+func (k *JSONWebKey) Thumbprint() (string, error) {
+	var canonical string
+	switch key := k.Key.(type) {
+	case *rsa.PublicKey:
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			encode(big.NewInt(int64(key.E)).Bytes()), encode(key.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			key.Curve.Params().Name, encode(padded(key.X, size)), encode(padded(key.Y, size)))
+	case ed25519.PublicKey:
+		canonical = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, encode(key))
+	default:
+		return "", fmt.Errorf("Unsupported key type %T", k.Key)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return encode(sum[:]), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// padded returns the big-endian bytes of i with leading zeros up to size, as required for the EC coordinates
+func padded(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,42 @@
+package jwk
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestThumbprint(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  string
+	}{
+		// https://tools.ietf.org/html/rfc7638#section-3.1
+		{`{"kty": "RSA", "kid": "2011-04-29", "alg": "RS256", "e": "AQAB", "n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}`,
+			"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		// https://tools.ietf.org/html/rfc8037#appendix-A.3
+		{`{"kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+			"kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	} {
+		var k JSONWebKey
+		if err := json.Unmarshal([]byte(test.input), &k); err != nil {
+			t.Fatal("Failed to parse the key: ", err)
+		}
+		got, err := k.Thumbprint()
+		if err != nil || got != test.want {
+			t.Errorf("Wrong thumbprint. Wanted %q, got %q, %v", test.want, got, err)
+		}
+	}
+
+	var a, b JSONWebKey
+	json.Unmarshal([]byte(`{"kty": "EC", "crv": "P-256", "kid": "a", "alg": "ES256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}`), &a)
+	json.Unmarshal([]byte(`{"kty": "EC", "crv": "P-256", "kid": "b", "use": "sig", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}`), &b)
+	ta, errA := a.Thumbprint()
+	tb, errB := b.Thumbprint()
+	if errA != nil || errB != nil || ta != tb {
+		t.Errorf("Thumbprints should only depend on the key material. Got %q, %q", ta, tb)
+	}
+
+	if _, err := (&JSONWebKey{Key: "foo"}).Thumbprint(); err == nil {
+		t.Error("Unsupported key types should fail")
+	}
+}
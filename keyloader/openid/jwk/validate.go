@@ -0,0 +1,50 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMissingKeyID should be used whenever a key has no kid and can't be referenced by tokens
+	ErrMissingKeyID = errors.New("Missing key ID")
+	// ErrWeakRSAKey should be used whenever the modulus of an RSA key is smaller than the accepted size
+	ErrWeakRSAKey = errors.New("RSA key is too small")
+	// ErrInvalidRSAExponent should be used whenever the public exponent of an RSA key is not usable
+	ErrInvalidRSAExponent = errors.New("Invalid RSA public exponent")
+	// ErrInvalidECDSAPoint should be used whenever the ECDSA public point is not on its curve
+	ErrInvalidECDSAPoint = errors.New("ECDSA point is not on the curve")
+)
+
+// Validate checks that the key is safe to verify signatures with: it must have a key ID, RSA keys must
+// have at least minRSABits and an odd exponent greater than 1 and ECDSA points must be on their curve.
+// Unlike UnmarshalJSON, which only checks the structure of the key, this is meant to be used by the
+// key loaders before the key is made available
+func (k *JSONWebKey) Validate(minRSABits int) error {
+	if k.KeyID == "" {
+		return ErrMissingKeyID
+	}
+	switch key := k.Key.(type) {
+	case *rsa.PublicKey:
+		if key.N == nil || key.N.BitLen() < minRSABits {
+			return ErrWeakRSAKey
+		}
+		if key.E < 3 || key.E%2 == 0 {
+			return ErrInvalidRSAExponent
+		}
+	case *ecdsa.PublicKey:
+		if key.X == nil || key.Y == nil || !key.Curve.IsOnCurve(key.X, key.Y) {
+			return ErrInvalidECDSAPoint
+		}
+	case ed25519.PublicKey:
+		if len(key) != ed25519.PublicKeySize {
+			return ErrInvalidEd25519PublicKey
+		}
+	default:
+		return fmt.Errorf("Unsupported key type %T", k.Key)
+	}
+	return nil
+}
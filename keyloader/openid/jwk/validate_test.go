@@ -0,0 +1,43 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	modulus := func(bits uint) *big.Int {
+		return new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), bits-1), big.NewInt(1))
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for name, test := range map[string]struct {
+		key  JSONWebKey
+		want error
+	}{
+		"rsa":            {JSONWebKey{KeyID: "k", Key: &rsa.PublicKey{N: modulus(2048), E: 65537}}, nil},
+		"rsa-weak":       {JSONWebKey{KeyID: "k", Key: &rsa.PublicKey{N: modulus(1024), E: 65537}}, ErrWeakRSAKey},
+		"rsa-e-1":        {JSONWebKey{KeyID: "k", Key: &rsa.PublicKey{N: modulus(2048), E: 1}}, ErrInvalidRSAExponent},
+		"rsa-e-even":     {JSONWebKey{KeyID: "k", Key: &rsa.PublicKey{N: modulus(2048), E: 65536}}, ErrInvalidRSAExponent},
+		"rsa-e-overflow": {JSONWebKey{KeyID: "k", Key: &rsa.PublicKey{N: modulus(2048), E: 0}}, ErrInvalidRSAExponent},
+		"ecdsa":          {JSONWebKey{KeyID: "k", Key: &ecKey.PublicKey}, nil},
+		"ecdsa-off-curve": {JSONWebKey{KeyID: "k", Key: &ecdsa.PublicKey{Curve: elliptic.P256(),
+			X: ecKey.X, Y: new(big.Int).Add(ecKey.Y, big.NewInt(1))}}, ErrInvalidECDSAPoint},
+		"ed25519":     {JSONWebKey{KeyID: "k", Key: edKey}, nil},
+		"missing-kid": {JSONWebKey{Key: &ecKey.PublicKey}, ErrMissingKeyID},
+	} {
+		if err := test.key.Validate(2048); err != test.want {
+			t.Errorf("%s: wanted error %v, got %v", name, test.want, err)
+		}
+	}
+
+	if err := (&JSONWebKey{KeyID: "k", Key: "foo"}).Validate(2048); err == nil {
+		t.Error("Unsupported key types should be rejected")
+	}
+}
@@ -0,0 +1,139 @@
+package jwk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrCertificateKeyMismatch should be used whenever the key of the first x5c certificate is not the JWK key
+	ErrCertificateKeyMismatch = errors.New("Certificate doesn't match the key")
+	// ErrCertificateThumbprintMismatch should be used whenever the x5t or x5t#S256 thumbprints don't match the certificate
+	ErrCertificateThumbprintMismatch = errors.New("Certificate thumbprint doesn't match")
+	// ErrCertificateExpired should be used whenever a certificate of the x5c chain is expired or not valid yet
+	ErrCertificateExpired = errors.New("Certificate expired or not valid yet")
+)
+
+// parseCertificates decodes the x5c chain. Unlike the other JWK parameters, the certificates
+// are encoded with standard base64
+// Ref:
+//
+//	https://tools.ietf.org/html/rfc7517#section-4.7
+func parseCertificates(x5c []string) ([]*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, nil
+	}
+	certs := make([]*x509.Certificate, len(x5c))
+	for i, c := range x5c {
+		der, err := base64.StdEncoding.DecodeString(c)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid x5c certificate %d: %v", i, err)
+		}
+		if certs[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("Invalid x5c certificate %d: %v", i, err)
+		}
+	}
+	return certs, nil
+}
+
+func (key *jsonWebKeyHelper) certificateKey() interface{} {
+	if len(key.certs) == 0 {
+		return nil
+	}
+	return key.certs[0].PublicKey
+}
+
+// checkCertificates verifies that the x5c chain could be parsed and that the first certificate has the same key as
+// the JWK and matches the thumbprints. Without certificates, the thumbprints can't be verified and are kept as they are
+func (k *JSONWebKey) checkCertificates() error {
+	if k.certificatesErr != nil {
+		return k.certificatesErr
+	}
+	if len(k.Certificates) == 0 {
+		return nil
+	}
+
+	leaf := k.Certificates[0]
+	if !sameKey(k.Key, leaf.PublicKey) {
+		return ErrCertificateKeyMismatch
+	}
+
+	if k.CertificateThumbprintSHA1 != nil {
+		sum := sha1.Sum(leaf.Raw)
+		if !bytes.Equal(sum[:], k.CertificateThumbprintSHA1) {
+			return ErrCertificateThumbprintMismatch
+		}
+	}
+
+	if k.CertificateThumbprintSHA256 != nil {
+		sum := sha256.Sum256(leaf.Raw)
+		if !bytes.Equal(sum[:], k.CertificateThumbprintSHA256) {
+			return ErrCertificateThumbprintMismatch
+		}
+	}
+	return nil
+}
+
+// CheckValidity checks that all the certificates of the x5c chain are valid at the time now, without verifying
+// the chain. It's cheap enough to be done on every use of the key. Keys without certificates are always valid
+func (k *JSONWebKey) CheckValidity(now time.Time) error {
+	for _, c := range k.Certificates {
+		if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+			return ErrCertificateExpired
+		}
+	}
+	return nil
+}
+
+// VerifyCertificates checks that the x5c chain was valid when the key was read, with the key and the thumbprints
+// of its first certificate, and that all the certificates are valid at the time now. If roots is not nil, the chain
+// must also lead to one of the roots. Keys without certificates are always valid
+func (k *JSONWebKey) VerifyCertificates(roots *x509.CertPool, now time.Time) error {
+	if err := k.checkCertificates(); err != nil {
+		return err
+	}
+	if err := k.CheckValidity(now); err != nil {
+		return err
+	}
+
+	if len(k.Certificates) == 0 || roots == nil {
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range k.Certificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := k.Certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
+
+func sameKey(a interface{}, b interface{}) bool {
+	switch ka := a.(type) {
+	case *rsa.PublicKey:
+		kb, ok := b.(*rsa.PublicKey)
+		return ok && ka.E == kb.E && ka.N.Cmp(kb.N) == 0
+	case *ecdsa.PublicKey:
+		kb, ok := b.(*ecdsa.PublicKey)
+		return ok && ka.Curve == kb.Curve && ka.X.Cmp(kb.X) == 0 && ka.Y.Cmp(kb.Y) == 0
+	case ed25519.PublicKey:
+		kb, ok := b.(ed25519.PublicKey)
+		return ok && bytes.Equal(ka, kb)
+	default:
+		return false
+	}
+}
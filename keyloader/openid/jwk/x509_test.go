@@ -0,0 +1,134 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestCertificate returns a certificate for the key pub, signed by the parent certificate with the
+// parentKey or self signed if parent is nil
+func newTestCertificate(t *testing.T, pub *ecdsa.PublicKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, notAfter time.Time) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal("Failed to create the certificate: ", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Failed to parse the certificate: ", err)
+	}
+	return cert
+}
+
+func TestCertificates(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := newTestCertificate(t, &caKey.PublicKey, nil, caKey, time.Now().Add(time.Hour))
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := newTestCertificate(t, &key.PublicKey, ca, caKey, time.Now().Add(time.Hour))
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	x5c := base64.StdEncoding.EncodeToString(leaf.Raw)
+	sha1Sum := sha1.Sum(leaf.Raw)
+	sha256Sum := sha256.Sum256(leaf.Raw)
+	x5t := base64.RawURLEncoding.EncodeToString(sha1Sum[:])
+	x5tS256 := base64.RawURLEncoding.EncodeToString(sha256Sum[:])
+	coord := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+
+	for _, test := range []struct {
+		input      string
+		shouldFail bool
+	}{
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x5c":["%s"]}`, x5c), false},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x5c":["%s"],"x5t":"%s","x5t#S256":"%s"}`, x5c, x5t, x5tS256), false},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x":"%s","y":"%s","x5c":["%s"]}`, coord(key.X), coord(key.Y), x5c), false},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x":"%s","y":"%s","x5c":["%s"]}`, coord(other.X), coord(other.Y), x5c), true},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x5c":["%s"],"x5t":"%s"}`, x5c, x5tS256), true},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-256","kid":"k","x5c":["%s"],"x5t#S256":"%s"}`, x5c, x5t), true},
+		{fmt.Sprintf(`{"kty":"EC","crv":"P-384","kid":"k","x5c":["%s"]}`, x5c), true},
+		{fmt.Sprintf(`{"kty":"RSA","kid":"k","x5c":["%s"]}`, x5c), true},
+		{`{"kty":"EC","crv":"P-256","kid":"k","x5c":["Zm9v"]}`, true},
+		{`{"kty":"EC","crv":"P-256","kid":"k","x5c":["-"]}`, true},
+	} {
+		k := new(JSONWebKey)
+		err := json.Unmarshal([]byte(test.input), k)
+		if err == nil {
+			err = k.VerifyCertificates(nil, time.Now())
+		}
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("Expected failure for %s", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.input, err)
+			continue
+		}
+		if !sameKey(k.Key, &key.PublicKey) {
+			t.Errorf("Wrong key for %s", test.input)
+		}
+		if len(k.Certificates) != 1 || !k.Certificates[0].Equal(leaf) {
+			t.Errorf("Wrong certificates for %s", test.input)
+		}
+	}
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := newTestCertificate(t, &caKey.PublicKey, nil, caKey, time.Now().Add(time.Hour))
+	otherCAKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherCA := newTestCertificate(t, &otherCAKey.PublicKey, nil, otherCAKey, time.Now().Add(time.Hour))
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := newTestCertificate(t, &key.PublicKey, ca, caKey, time.Now().Add(time.Hour))
+	expired := newTestCertificate(t, &key.PublicKey, ca, caKey, time.Now().Add(-time.Minute))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherCA)
+
+	for i, test := range []struct {
+		certs      []*x509.Certificate
+		roots      *x509.CertPool
+		shouldFail bool
+	}{
+		{nil, roots, false},
+		{[]*x509.Certificate{leaf}, nil, false},
+		{[]*x509.Certificate{leaf, ca}, nil, false},
+		{[]*x509.Certificate{leaf}, roots, false},
+		{[]*x509.Certificate{leaf}, otherRoots, true},
+		{[]*x509.Certificate{expired}, nil, true},
+		{[]*x509.Certificate{expired}, roots, true},
+	} {
+		k := &JSONWebKey{Key: &key.PublicKey, Certificates: test.certs}
+		err := k.VerifyCertificates(test.roots, time.Now())
+		if test.shouldFail && err == nil {
+			t.Errorf("Test %d: expected the certificates to be rejected", i)
+		}
+		if !test.shouldFail && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package openid
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+// multiIssuerLoader holds one caching loader per trusted OpenID provider. Each loader has its own
+// key cache and refresh schedule
+type multiIssuerLoader struct {
+	loaders []*cachingOpenIDProviderLoader
+}
+
+// NewMultiIssuerLoader returns an IssuerKeyLoader with keys from all the OpenID providers. Keys are
+// selected by the issuer each provider announces in its configuration discovery document and a
+// key is never used for tokens of another issuer
+func NewMultiIssuerLoader(providers []options.OpenIDProvider) keyloader.JWKLoader {
+	m := &multiIssuerLoader{loaders: make([]*cachingOpenIDProviderLoader, len(providers))}
+	for i, p := range providers {
+		log.Printf("Trusting OpenID provider %s (refresh every %v)", p.ConfigurationURL, p.RefreshInterval)
+		m.loaders[i] = newCachingOpenIDProviderLoader(p.ConfigurationURL, p.RefreshInterval)
+	}
+	return m
+}
+
+// LoadIssuerKey looks up the key id in the providers that accept the issuer. When the key is only
+// available from other issuers, keyloader.ErrIssuerMismatch is returned
+func (m *multiIssuerLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	k, err := m.LoadIssuerJWK(issuer, id)
+	if err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+// LoadIssuerJWK is like LoadIssuerKey but returns the whole JWK, including its algorithm and use.
+// Unknown keys trigger an on demand refresh of the providers that accept the issuer
+func (m *multiIssuerLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	k, err := m.lookupIssuerJWK(issuer, id)
+	if err == errKeyNotFound && m.refreshOnDemand(issuer) {
+		k, err = m.lookupIssuerJWK(issuer, id)
+	}
+	if err == errKeyNotFound {
+		return k, fmt.Errorf("Key '%s' not found", id)
+	}
+	return k, err
+}
+
+func (m *multiIssuerLoader) lookupIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	mismatch := false
+	for _, kl := range m.loaders {
+		k, err := kl.lookupIssuerJWK(issuer, id)
+		if err == nil {
+			return k, nil
+		}
+		if err == keyloader.ErrIssuerMismatch {
+			mismatch = true
+		}
+	}
+	if mismatch {
+		return jwk.JSONWebKey{}, keyloader.ErrIssuerMismatch
+	}
+	return jwk.JSONWebKey{}, errKeyNotFound
+}
+
+// refreshOnDemand refreshes, in parallel, the providers with the issuer or whose issuer is still unknown.
+// It returns true if any of them was refreshed
+func (m *multiIssuerLoader) refreshOnDemand(issuer string) bool {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		refreshed bool
+	)
+	for _, kl := range m.loaders {
+		if iss := kl.Issuer(); iss != "" && issuer != "" && iss != issuer {
+			continue
+		}
+		wg.Add(1)
+		go func(kl *cachingOpenIDProviderLoader) {
+			defer wg.Done()
+			if kl.refreshOnDemand() {
+				mu.Lock()
+				refreshed = true
+				mu.Unlock()
+			}
+		}(kl)
+	}
+	wg.Wait()
+	return refreshed
+}
+
+// Issuers returns the issuers discovered so far from all the providers
+func (m *multiIssuerLoader) Issuers() []string {
+	var issuers []string
+	for _, kl := range m.loaders {
+		issuers = append(issuers, kl.Issuers()...)
+	}
+	return issuers
+}
+
+// LoadKey returns the first key with the id from any of the providers. Unknown keys trigger an on demand
+// refresh of all the providers
+func (m *multiIssuerLoader) LoadKey(id string) (interface{}, error) {
+	if k := m.lookupKey(id); k != nil {
+		return k, nil
+	}
+	if m.refreshOnDemand("") {
+		if k := m.lookupKey(id); k != nil {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("Key '%s' not found", id)
+}
+
+func (m *multiIssuerLoader) lookupKey(id string) interface{} {
+	for _, kl := range m.loaders {
+		if k, ok := kl.lookupKey(id); ok {
+			return k.Key
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys from all the providers, named by keyloader.KeyName
+func (m *multiIssuerLoader) Keys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	for _, kl := range m.loaders {
+		addKeys(keys, kl)
+	}
+	return keys
+}
+
+// PublishedKeys returns only the keys of the first provider. The keys of the additional providers are used to
+// validate their tokens but they are not ours to publish
+func (m *multiIssuerLoader) PublishedKeys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	addKeys(keys, m.loaders[0])
+	return keys
+}
+
+func addKeys(keys map[string]interface{}, kl *cachingOpenIDProviderLoader) {
+	issuer := kl.Issuer()
+	for kid, k := range kl.Keys() {
+		keys[keyloader.KeyName(issuer, kid)] = k
+	}
+}
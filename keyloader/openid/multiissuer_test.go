@@ -0,0 +1,115 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func newProviderServer(issuer string, x string, y string) *httptest.Server {
+	var listener string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "%s", "jwks_uri": "%s/oauth2/v3/certs"}`, issuer, listener)
+		} else {
+			fmt.Fprintf(w, `{"keys": [{"alg": "ES256", "crv": "P-256", "kid": "testkey", "kty": "EC", "use": "sig", "x": "%s", "y": "%s"}]}`, x, y)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	listener = fmt.Sprintf("http://%s", server.Listener.Addr())
+	return server
+}
+
+func TestMultiIssuerLoader(t *testing.T) {
+	s1 := newProviderServer("PlanB", "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs")
+	defer s1.Close()
+	s2 := newProviderServer("Partner", "FDrM1mhj9Q4gvELNEVSe6UPKNjjVuAtgt04ro9dCchU", "HTGUAM_1N_9bDYOW2W_nRDX64JXw41ja6DxpbSPaEsA")
+	defer s2.Close()
+
+	u1, _ := url.Parse(s1.URL + "/.well-known/openid-configuration")
+	u2, _ := url.Parse(s2.URL + "/.well-known/openid-configuration")
+	kl := NewMultiIssuerLoader([]options.OpenIDProvider{
+		{ConfigurationURL: u1, RefreshInterval: time.Minute},
+		{ConfigurationURL: u2, RefreshInterval: time.Hour},
+	})
+	for _, l := range kl.(*multiIssuerLoader).loaders {
+		l.refreshKeys()
+	}
+
+	k1, err := kl.LoadIssuerKey("PlanB", "testkey")
+	if err != nil {
+		t.Fatal("Failed to load key `testkey` from PlanB: ", err)
+	}
+	k2, err := kl.LoadIssuerKey("Partner", "testkey")
+	if err != nil {
+		t.Fatal("Failed to load key `testkey` from Partner: ", err)
+	}
+	if k1.(*ecdsa.PublicKey).X.Cmp(k2.(*ecdsa.PublicKey).X) == 0 {
+		t.Error("Keys with the same id from different issuers should not collide")
+	}
+
+	if k, err := kl.LoadIssuerJWK("Partner", "testkey"); err != nil || k.Algorithm != "ES256" || k.Use != "sig" || k.Key != k2 {
+		t.Errorf("Unexpected JWK for `testkey` from Partner: %+v, %v", k, err)
+	}
+
+	if _, err := kl.LoadIssuerKey("Unknown", "testkey"); err != keyloader.ErrIssuerMismatch {
+		t.Errorf("Keys should not be used for unknown issuers. Wanted %v, got %v", keyloader.ErrIssuerMismatch, err)
+	}
+
+	if k, err := kl.LoadKey("testkey"); err != nil || k != k1 {
+		t.Errorf("LoadKey should return the first matching key. Got %v, %v", k, err)
+	}
+
+	issuers := kl.Issuers()
+	if len(issuers) != 2 || issuers[0] != "PlanB" || issuers[1] != "Partner" {
+		t.Errorf("Unexpected issuers %v", issuers)
+	}
+
+	if _, err := kl.LoadIssuerKey("Partner", "missing-key"); err == nil {
+		t.Error("Key 'missing-key' should not be retrieved from the key cache")
+	}
+	loaders := kl.(*multiIssuerLoader).loaders
+	if !loaders[0].lastRefresh.IsZero() || loaders[1].lastRefresh.IsZero() {
+		t.Error("Unknown keys should only refresh the providers of the token issuer")
+	}
+
+	if _, err := kl.LoadKey("missing-key"); err == nil {
+		t.Error("Key 'missing-key' should not be retrieved from any key cache")
+	}
+
+	m := kl.Keys()
+	if len(m) != 2 {
+		t.Errorf("Wrong amount of keys. Wanted 2, got %d", len(m))
+	}
+	for _, k := range []string{"PlanB/testkey", "Partner/testkey"} {
+		if _, has := m[k]; !has {
+			t.Errorf("Key map doesn't contain %q", k)
+		}
+	}
+
+	p := kl.(keyloader.KeyPublisher).PublishedKeys()
+	if _, has := p["PlanB/testkey"]; !has || len(p) != 1 {
+		t.Errorf("Only the keys of the first provider should be published. Got %v", p)
+	}
+}
+
+func TestSingleIssuerKeys(t *testing.T) {
+	s := newProviderServer("PlanB", "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs")
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL + "/.well-known/openid-configuration")
+	kl := NewMultiIssuerLoader([]options.OpenIDProvider{{ConfigurationURL: u, RefreshInterval: time.Minute}})
+	kl.(*multiIssuerLoader).loaders[0].refreshKeys()
+
+	if _, has := kl.Keys()["PlanB/testkey"]; !has {
+		t.Error("Key map of a single provider should also prefix the key ids with the issuer")
+	}
+}
@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
-	"github.com/zalando/planb-tokeninfo/breaker"
 	"github.com/zalando/planb-tokeninfo/caching"
 	"github.com/zalando/planb-tokeninfo/keyloader"
 	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
@@ -24,38 +23,273 @@ import (
 type cachingOpenIDProviderLoader struct {
 	url      string
 	keyCache *caching.Cache
+	mu       sync.RWMutex
+	issuer   string
+	retired  map[string]retiredKey
+
+	// conditional requests of the configuration and the JWKS
+	refreshInterval time.Duration
+	configResource  cachedResource
+	keysResource    cachedResource
+	config          *configuration
+
+	// on demand refreshes of unknown keys
+	refreshMu   sync.Mutex
+	refreshing  chan struct{}
+	lastRefresh time.Time
 }
 
 const (
 	metricsNoKeysError = "planb.openidprovider.errors.nokeys"
 	metricsNumKeys     = "planb.openidprovider.numkeys"
+
+	metricsKeyReplaced           = "planb.openidprovider.keyreplaced"
+	metricsKeyReplacementRefused = "planb.openidprovider.keyreplaced.refused"
+
+	metricsNumRetiredKeys  = "planb.openidprovider.numretiredkeys"
+	metricsRetiredKeysUsed = "planb.openidprovider.retiredkeys.used"
+
+	metricsCertificateError   = "planb.openidprovider.errors.certificate"
+	metricsCertificateExpired = "planb.openidprovider.errors.certificate.expired"
+	metricsInvalidKeyError    = "planb.openidprovider.errors.invalidkey"
+
+	metricsOnDemandRefresh     = "planb.openidprovider.ondemand.refresh"
+	metricsOnDemandRateLimited = "planb.openidprovider.ondemand.ratelimited"
+	metricsOnDemandTimeout     = "planb.openidprovider.ondemand.timeout"
+
+	metricsConfiguration = "configuration"
+	metricsJWKS          = "jwks"
 )
 
 var (
 	errInvalidResponseStatusCode = errors.New("Invalid response status code")
-	scheduleFunc                 = keyloader.Schedule
+	errKeyNotFound               = errors.New("Key not found")
+	scheduleFunc                 = keyloader.ScheduleWithInterval
 )
 
 // NewCachingOpenIDProviderLoader returns a KeyLoader that uses the configured URL to an OpenID
 // endpoint where the URI for the JSON Web Keys Set is available
 func NewCachingOpenIDProviderLoader(u *url.URL) keyloader.KeyLoader {
-	kl := &cachingOpenIDProviderLoader{url: u.String(), keyCache: caching.NewCache()}
-	scheduleFunc(options.AppSettings.OpenIDProviderRefreshInterval, kl.refreshKeys)
+	return newCachingOpenIDProviderLoader(u, options.AppSettings.OpenIDProviderRefreshInterval)
+}
+
+func newCachingOpenIDProviderLoader(u *url.URL, refreshInterval time.Duration) *cachingOpenIDProviderLoader {
+	kl := &cachingOpenIDProviderLoader{url: u.String(), keyCache: caching.NewCache(), refreshInterval: refreshInterval}
+	kl.loadSnapshot()
+	scheduleFunc(kl.nextRefresh, kl.refreshKeys)
 	return kl
 }
 
+// nextRefresh returns the interval until the next scheduled refresh. It is the max-age of the last JWKS
+// response, within the configured bounds, or the refresh interval of the provider without a max-age
+func (kl *cachingOpenIDProviderLoader) nextRefresh() time.Duration {
+	d, ok := kl.keysResource.freshness()
+	if !ok {
+		return kl.refreshInterval
+	}
+	if min := options.AppSettings.OpenIDProviderMinRefreshInterval; d < min {
+		d = min
+	}
+	if max := options.AppSettings.OpenIDProviderMaxRefreshInterval; d > max {
+		d = max
+	}
+	return d
+}
+
+// LoadKey returns the key with the id. Unknown keys trigger an on demand refresh of the keys
 func (kl *cachingOpenIDProviderLoader) LoadKey(id string) (interface{}, error) {
-	v := kl.keyCache.Get(id)
-	if v == nil {
+	k, ok := kl.lookupKey(id)
+	if !ok && kl.refreshOnDemand() {
+		k, ok = kl.lookupKey(id)
+	}
+	if !ok {
 		return nil, fmt.Errorf("Key '%s' not found", id)
 	}
-	return v.(jwk.JSONWebKey).Key, nil
+	return k.Key, nil
+}
+
+// retiredKey is a key that is no longer published by the provider but is still accepted until the end of
+// the grace period, so that tokens signed with it remain valid
+type retiredKey struct {
+	key       jwk.JSONWebKey
+	retiredAt time.Time
+}
+
+// lookupKey returns the published key with the id or the retired key during its grace period. Keys whose x5c
+// certificates expired since they were loaded are not returned
+func (kl *cachingOpenIDProviderLoader) lookupKey(id string) (jwk.JSONWebKey, bool) {
+	k, ok := kl.cachedKey(id)
+	if !ok {
+		return k, false
+	}
+	if err := k.CheckValidity(time.Now()); err != nil {
+		incCounter(metricsCertificateExpired)
+		return jwk.JSONWebKey{}, false
+	}
+	return k, true
+}
+
+func (kl *cachingOpenIDProviderLoader) cachedKey(id string) (jwk.JSONWebKey, bool) {
+	if v := kl.keyCache.Get(id); v != nil {
+		return v.(jwk.JSONWebKey), true
+	}
+	kl.mu.RLock()
+	r, has := kl.retired[id]
+	kl.mu.RUnlock()
+	if !has || time.Since(r.retiredAt) > options.AppSettings.OpenIDProviderKeyGracePeriod {
+		return jwk.JSONWebKey{}, false
+	}
+	incCounter(metricsRetiredKeysUsed)
+	return r.key, true
+}
+
+// retireKeys keeps the keys from previous that are not in current as retired keys for the grace period. Retired
+// keys that are published again or whose grace period is over are removed
+func (kl *cachingOpenIDProviderLoader) retireKeys(previous map[string]interface{}, current map[string]interface{}) {
+	grace := options.AppSettings.OpenIDProviderKeyGracePeriod
+	now := time.Now()
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.retired == nil {
+		kl.retired = make(map[string]retiredKey)
+	}
+	for kid, k := range kl.retired {
+		if _, has := current[kid]; has {
+			log.Printf("Retired public key %q is published again\n", kid)
+			delete(kl.retired, kid)
+		} else if now.Sub(k.retiredAt) > grace {
+			log.Printf("Removing retired public key %q (%s) after the grace period\n", kid, k.key.Algorithm)
+			delete(kl.retired, kid)
+		}
+	}
+	if grace > 0 {
+		for kid, k := range previous {
+			if _, has := current[kid]; !has {
+				key := k.(jwk.JSONWebKey)
+				log.Printf("Retiring public key %q (%s), it will be accepted for %v\n", kid, key.Algorithm, grace)
+				kl.retired[kid] = retiredKey{key: key, retiredAt: now}
+			}
+		}
+	}
+
+	if g, ok := metrics.DefaultRegistry.GetOrRegister(metricsNumRetiredKeys, metrics.NewGauge).(metrics.Gauge); ok {
+		g.Update(int64(len(kl.retired)))
+	}
 }
 
 func (kl *cachingOpenIDProviderLoader) Keys() map[string]interface{} {
 	return kl.keyCache.Snapshot()
 }
 
+// LoadIssuerKey returns the key with the id only if the issuer matches the one from the discovery
+// document. Without a discovered issuer, the key is returned for any issuer
+func (kl *cachingOpenIDProviderLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	k, err := kl.LoadIssuerJWK(issuer, id)
+	if err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+// LoadIssuerJWK is like LoadIssuerKey but returns the whole JWK, including its algorithm and use.
+// Unknown keys trigger an on demand refresh of the keys
+func (kl *cachingOpenIDProviderLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	k, err := kl.lookupIssuerJWK(issuer, id)
+	if err == errKeyNotFound && kl.refreshOnDemand() {
+		k, err = kl.lookupIssuerJWK(issuer, id)
+	}
+	if err == errKeyNotFound {
+		return k, fmt.Errorf("Key '%s' not found", id)
+	}
+	return k, err
+}
+
+// lookupIssuerJWK looks up the key in the cache, without refreshing it
+func (kl *cachingOpenIDProviderLoader) lookupIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	k, ok := kl.lookupKey(id)
+	if !ok {
+		return jwk.JSONWebKey{}, errKeyNotFound
+	}
+	if iss := kl.Issuer(); iss != "" && iss != issuer {
+		return jwk.JSONWebKey{}, keyloader.ErrIssuerMismatch
+	}
+	return k, nil
+}
+
+// Issuer returns the issuer from the last successfully loaded configuration or an empty string
+// if the configuration was never loaded
+func (kl *cachingOpenIDProviderLoader) Issuer() string {
+	kl.mu.RLock()
+	defer kl.mu.RUnlock()
+	return kl.issuer
+}
+
+// Issuers returns a list with the discovered issuer, if any
+func (kl *cachingOpenIDProviderLoader) Issuers() []string {
+	if iss := kl.Issuer(); iss != "" {
+		return []string{iss}
+	}
+	return nil
+}
+
+func (kl *cachingOpenIDProviderLoader) setIssuer(issuer string) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.issuer != issuer {
+		log.Printf("Discovered issuer %q from %q\n", issuer, kl.url)
+	}
+	kl.issuer = issuer
+}
+
+// refreshOnDemand refreshes the keys after the lookup of an unknown key, so that tokens signed with
+// newly rotated keys are accepted without waiting for the next scheduled refresh. Concurrent callers
+// share the same refresh and a new one is only started once per OpenIDProviderOnDemandInterval, so
+// that unknown key IDs can't be used to flood the provider. It waits up to OpenIDProviderOnDemandTimeout
+// for the refresh and returns true if the refresh finished in time
+func (kl *cachingOpenIDProviderLoader) refreshOnDemand() bool {
+	timeout := options.AppSettings.OpenIDProviderOnDemandTimeout
+	if timeout <= 0 {
+		return false
+	}
+
+	kl.refreshMu.Lock()
+	done := kl.refreshing
+	if done == nil {
+		if !kl.lastRefresh.IsZero() && time.Since(kl.lastRefresh) < options.AppSettings.OpenIDProviderOnDemandInterval {
+			kl.refreshMu.Unlock()
+			incCounter(metricsOnDemandRateLimited)
+			return false
+		}
+		done = make(chan struct{})
+		kl.refreshing = done
+		kl.lastRefresh = time.Now()
+		incCounter(metricsOnDemandRefresh)
+		go func() {
+			kl.refreshKeys()
+			kl.refreshMu.Lock()
+			kl.refreshing = nil
+			kl.refreshMu.Unlock()
+			close(done)
+		}()
+	}
+	kl.refreshMu.Unlock()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		incCounter(metricsOnDemandTimeout)
+		return false
+	}
+}
+
+func incCounter(key string) {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(key, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
+
 // Example: https://www.googleapis.com/oauth2/v3/certs
 func (kl *cachingOpenIDProviderLoader) refreshKeys() {
 	log.Println("Refreshing keys..")
@@ -67,81 +301,135 @@ func (kl *cachingOpenIDProviderLoader) refreshKeys() {
 		return
 	}
 
+	kl.setIssuer(c.Issuer)
+
 	log.Println("Configuration loaded successfully, loading JWKS..")
-	resp, err := breaker.Get("loadKeys", c.JwksURI)
+	body, modified, err := kl.keysResource.fetch("loadKeys", metricsJWKS, c.JwksURI)
 	if err != nil {
-		log.Println("Failed to get JWKS from ", c.JwksURI)
+		log.Printf("Failed to get JWKS from %q: %v\n", c.JwksURI, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Failed to read JWKS response body from %q: %v\n", c.JwksURI, err)
+	if !modified {
+		log.Println("JWKS not modified, keeping the current keys..")
+		kl.retireKeys(nil, kl.keyCache.Snapshot())
 		return
 	}
 
 	log.Println("JWKS loaded successfully, parsing JWKS..")
+	if !kl.updateKeys(body) {
+		kl.keysResource.invalidate()
+		return
+	}
+	kl.saveSnapshot(c.Issuer)
+	log.Println("Refresh done..")
+}
+
+// updateKeys parses the JWKS and replaces the keys in the cache with the valid ones. It returns false
+// if the JWKS couldn't be parsed or had no valid keys, in which case the current keys are kept
+func (kl *cachingOpenIDProviderLoader) updateKeys(body []byte) bool {
 	jwks := new(jwk.JSONWebKeySet)
-	if err = json.Unmarshal(body, jwks); err != nil {
+	if err := json.Unmarshal(body, jwks); err != nil {
 		log.Println("Failed to parse JWKS: ", err)
-		return
+		return false
+	}
+
+	newKeys := jwks.ToMap()
+	for kid, k := range newKeys {
+		key := k.(jwk.JSONWebKey)
+		if err := key.Validate(options.AppSettings.JWKSMinRSAKeySize); err != nil {
+			log.Printf("Rejecting invalid public key %q: %v\n", kid, err)
+			if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsInvalidKeyError, metrics.NewCounter).(metrics.Counter); ok {
+				c.Inc(1)
+			}
+			delete(newKeys, kid)
+			continue
+		}
+		if err := key.VerifyCertificates(options.AppSettings.JWKSRootCAs, time.Now()); err != nil {
+			log.Printf("Rejecting public key %q with invalid certificates: %v\n", kid, err)
+			if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsCertificateError, metrics.NewCounter).(metrics.Counter); ok {
+				c.Inc(1)
+			}
+			delete(newKeys, kid)
+		}
 	}
 
 	// safety first: only remove public keys if our newly
 	// received list contains at least one public key!
 	// (we don't want our tokeninfo to run out of public keys
 	// just because somebody cleared the provider database)
-	numKeys := len(jwks.Keys)
+	numKeys := len(newKeys)
 	if numKeys < 1 {
 		log.Println("No JWKS currently in the OpenID provider")
 		if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsNoKeysError, metrics.NewCounter).(metrics.Counter); ok {
 			c.Inc(1)
 		}
-		return
+		return false
 	}
 
 	if g, ok := metrics.DefaultRegistry.GetOrRegister(metricsNumKeys, metrics.NewGauge).(metrics.Gauge); ok {
 		g.Update(int64(numKeys))
 	}
 
-	newKeys := jwks.ToMap()
 	for kid, k := range newKeys {
 		key := k.(jwk.JSONWebKey)
 		existing := kl.keyCache.Get(kid)
 		if existing == nil {
 			log.Printf("Received new public key %q (%s)\n", kid, key.Algorithm)
 		} else if !reflect.DeepEqual(existing, key) {
-			// this is potentially dangerous: the key contents changed..
-			// (but maybe the key wasn't used for signing yet, so it might be ok)
-			log.Printf("Received a replacement public key for existing key %q (%s)", kid, key.Algorithm)
+			if !kl.replaceKey(existing.(jwk.JSONWebKey), key) {
+				newKeys[kid] = existing
+			}
 		}
 	}
 
 	log.Printf("Resetting key cache with %d key(s)..", numKeys)
-	kl.keyCache.Reset(newKeys)
-	log.Println("Refresh done..")
+	previous := kl.keyCache.Reset(newKeys)
+	kl.retireKeys(previous, newKeys)
+	return true
+}
+
+// replaceKey decides whether the existing key can be replaced by a key with the same id. Keys whose material
+// changed are potentially dangerous, as tokens signed with the previous key are rejected or, worse, somebody
+// else could be signing tokens now. These replacements are audited with the RFC 7638 thumbprints of both keys,
+// counted and, with OpenIDRefuseKeyReplacement, refused
+func (kl *cachingOpenIDProviderLoader) replaceKey(existing jwk.JSONWebKey, key jwk.JSONWebKey) bool {
+	previous, _ := existing.Thumbprint()
+	current, _ := key.Thumbprint()
+	if previous == current {
+		log.Printf("Received new parameters for existing key %q (%s)\n", key.KeyID, key.Algorithm)
+		return true
+	}
+
+	refuse := options.AppSettings.OpenIDRefuseKeyReplacement
+	log.Printf("AUDIT: key_replaced issuer=%q kid=%q alg=%q old_thumbprint=%q new_thumbprint=%q refused=%t\n",
+		kl.Issuer(), key.KeyID, key.Algorithm, previous, current, refuse)
+	incCounter(metricsKeyReplaced)
+	if refuse {
+		incCounter(metricsKeyReplacementRefused)
+		return false
+	}
+	return true
 }
 
 // https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationResponse
 func (kl *cachingOpenIDProviderLoader) loadConfiguration() (*configuration, error) {
-	resp, err := breaker.Get("loadConfiguration", kl.url)
+	body, modified, err := kl.configResource.fetch("loadConfiguration", metricsConfiguration, kl.url)
 	if err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errInvalidResponseStatusCode
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if !modified && kl.config != nil {
+		return kl.config, nil
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	config := new(configuration)
+	if err = json.Unmarshal(body, config); err != nil {
+		kl.configResource.invalidate()
 		return nil, err
 	}
-
-	config := new(configuration)
-	err = json.Unmarshal(body, config)
-	return config, err
+	kl.config = config
+	return config, nil
 }
@@ -2,22 +2,31 @@ package openid
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/rcrowley/go-metrics"
 	"github.com/zalando/planb-tokeninfo/caching"
 	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/options"
 )
 
 func init() {
 	scheduleFunc = noOpScheduler
 }
 
-func noOpScheduler(_ time.Duration, _ keyloader.JobFunc) {}
+func noOpScheduler(_ keyloader.IntervalFunc, _ keyloader.JobFunc) {}
 
 func TestLoadConfigurationFailure(t *testing.T) {
 	kc := caching.NewCache()
@@ -219,3 +228,344 @@ func TestInvalidJwksUri(t *testing.T) {
 		t.Error("Key amount should be 0")
 	}
 }
+
+func TestDiscoveredIssuer(t *testing.T) {
+	s := newProviderServer("PlanB", "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs")
+	defer s.Close()
+
+	kl := &cachingOpenIDProviderLoader{url: s.URL + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+	if kl.Issuer() != "" || kl.Issuers() != nil {
+		t.Errorf("Issuer should be empty before loading the configuration. Got %q", kl.Issuer())
+	}
+	if _, err := kl.LoadIssuerKey("Other", "testkey"); err == nil {
+		t.Error("Key 'testkey' should not be retrieved before loading the configuration")
+	}
+
+	kl.refreshKeys()
+	if kl.Issuer() != "PlanB" {
+		t.Errorf("Wrong discovered issuer. Wanted %q, got %q", "PlanB", kl.Issuer())
+	}
+
+	for _, test := range []struct {
+		issuer    string
+		wantError error
+	}{
+		{"PlanB", nil},
+		{"Other", keyloader.ErrIssuerMismatch},
+		{"", keyloader.ErrIssuerMismatch},
+	} {
+		k, err := kl.LoadIssuerKey(test.issuer, "testkey")
+		if err != test.wantError {
+			t.Errorf("Unexpected error for issuer %q. Wanted %v, got %v", test.issuer, test.wantError, err)
+		}
+		if (k == nil) == (test.wantError == nil) {
+			t.Errorf("Unexpected key for issuer %q: %v", test.issuer, k)
+		}
+	}
+}
+
+func TestRejectExpiredCertificates(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	certificate := func(notAfter time.Time) string {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		return base64.StdEncoding.EncodeToString(der)
+	}
+	coord := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	valid := certificate(time.Now().Add(time.Hour))
+	expired := certificate(time.Now().Add(-time.Minute))
+
+	var listener string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+		} else {
+			fmt.Fprintf(w, `{"keys": [{"kid": "valid", "kty": "EC", "crv": "P-256", "x5c": ["%s"]}, {"kid": "expired", "kty": "EC", "crv": "P-256", "x5c": ["%s"]}, `+
+				`{"kid": "mismatch", "kty": "EC", "crv": "P-256", "x5c": ["%s"], "x5t": "AAAA"}, {"kid": "garbage", "kty": "EC", "crv": "P-256", "x": "%s", "y": "%s", "x5c": ["Zm9v"]}]}`,
+				valid, expired, valid, coord(key.X), coord(key.Y))
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	listener = fmt.Sprintf("http://%s", server.Listener.Addr())
+	kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+	rejected := metrics.GetOrRegisterCounter(metricsCertificateError, metrics.DefaultRegistry).Count()
+	kl.refreshKeys()
+	if got := metrics.GetOrRegisterCounter(metricsCertificateError, metrics.DefaultRegistry).Count() - rejected; got != 3 {
+		t.Errorf("Wrong number of keys rejected because of their certificates. Wanted 3, got %d", got)
+	}
+
+	if _, err := kl.LoadKey("valid"); err != nil {
+		t.Error("Key `valid` should have been loaded: ", err)
+	}
+
+	for _, kid := range []string{"expired", "mismatch", "garbage"} {
+		if _, err := kl.LoadKey(kid); err == nil {
+			t.Errorf("Key %q should have been rejected", kid)
+		}
+	}
+
+	// the JWKS isn't modified, but the certificate of the loaded key expires
+	k, _ := kl.lookupKey("valid")
+	k.Certificates[0].NotAfter = time.Now().Add(-time.Second)
+	if _, err := kl.LoadKey("valid"); err == nil {
+		t.Error("Key `valid` should have been rejected after its certificate expired")
+	}
+	if _, err := kl.LoadIssuerJWK("PlanB", "valid"); err == nil {
+		t.Error("Key `valid` should have been rejected after its certificate expired")
+	}
+}
+
+func TestRejectInvalidKeys(t *testing.T) {
+	modulus := func(bits uint) string {
+		n := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), bits-1), big.NewInt(1))
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+
+	var listener string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+		} else {
+			fmt.Fprintf(w, `{"keys": [
+				{"kid": "valid", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"},
+				{"kid": "off-curve", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFw"},
+				{"kid": "rsa", "kty": "RSA", "n": "%s", "e": "AQAB"},
+				{"kid": "weak", "kty": "RSA", "n": "%s", "e": "AQAB"},
+				{"kid": "big-exponent", "kty": "RSA", "n": "%s", "e": "AQAAAAE"},
+				{"kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}
+			]}`, modulus(2048), modulus(512), modulus(2048))
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	defer func(timeout time.Duration) { options.AppSettings.OpenIDProviderOnDemandTimeout = timeout }(options.AppSettings.OpenIDProviderOnDemandTimeout)
+	options.AppSettings.OpenIDProviderOnDemandTimeout = 0
+
+	rejected := metrics.GetOrRegisterCounter(metricsInvalidKeyError, metrics.DefaultRegistry).Count()
+
+	listener = fmt.Sprintf("http://%s", server.Listener.Addr())
+	kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+	kl.refreshKeys()
+
+	for _, kid := range []string{"valid", "rsa"} {
+		if _, err := kl.LoadKey(kid); err != nil {
+			t.Errorf("Key %q should have been loaded: %v", kid, err)
+		}
+	}
+
+	for _, kid := range []string{"off-curve", "weak", "big-exponent", ""} {
+		if _, err := kl.LoadKey(kid); err == nil {
+			t.Errorf("Key %q should have been rejected", kid)
+		}
+	}
+
+	if got := metrics.GetOrRegisterCounter(metricsInvalidKeyError, metrics.DefaultRegistry).Count() - rejected; got != 4 {
+		t.Errorf("Wrong number of rejected keys. Wanted 4, got %d", got)
+	}
+}
+
+func TestOnDemandRefresh(t *testing.T) {
+	var (
+		listener string
+		requests int32
+		delay    = make(chan time.Duration, 1)
+	)
+	delay <- 0
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+			return
+		}
+		d := <-delay
+		delay <- d
+		time.Sleep(d)
+		kid := "testkey"
+		if atomic.AddInt32(&requests, 1) > 1 {
+			kid = "newkey"
+		}
+		fmt.Fprintf(w, `{"keys": [{"kid": "%s", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}]}`, kid)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	listener = fmt.Sprintf("http://%s", server.Listener.Addr())
+
+	defer func(interval, timeout time.Duration) {
+		options.AppSettings.OpenIDProviderOnDemandInterval = interval
+		options.AppSettings.OpenIDProviderOnDemandTimeout = timeout
+	}(options.AppSettings.OpenIDProviderOnDemandInterval, options.AppSettings.OpenIDProviderOnDemandTimeout)
+	options.AppSettings.OpenIDProviderOnDemandInterval = time.Hour
+	options.AppSettings.OpenIDProviderOnDemandTimeout = time.Second
+
+	kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+	kl.refreshKeys()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := kl.LoadIssuerJWK("PlanB", "newkey"); err != nil {
+				t.Error("Key `newkey` should have been loaded on demand: ", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("Concurrent lookups should share a single refresh. Wanted 2 JWKS requests, got %d", n)
+	}
+
+	if _, err := kl.LoadKey("unknown"); err == nil {
+		t.Error("Key `unknown` should not be found")
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("On demand refreshes should be rate limited. Wanted 2 JWKS requests, got %d", n)
+	}
+
+	<-delay
+	delay <- 500 * time.Millisecond
+	options.AppSettings.OpenIDProviderOnDemandTimeout = 10 * time.Millisecond
+	kl.lastRefresh = time.Time{}
+	start := time.Now()
+	if _, err := kl.LoadKey("unknown"); err == nil {
+		t.Error("Key `unknown` should not be found")
+	}
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("Waiting for the on demand refresh should be bounded, took %v", d)
+	}
+}
+
+func TestKeyGracePeriod(t *testing.T) {
+	var (
+		listener string
+		kid      = "old"
+	)
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+			return
+		}
+		fmt.Fprintf(w, `{"keys": [{"kid": "%s", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}]}`, kid)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	listener = server.URL
+
+	defer func(grace, timeout time.Duration) {
+		options.AppSettings.OpenIDProviderKeyGracePeriod = grace
+		options.AppSettings.OpenIDProviderOnDemandTimeout = timeout
+	}(options.AppSettings.OpenIDProviderKeyGracePeriod, options.AppSettings.OpenIDProviderOnDemandTimeout)
+	options.AppSettings.OpenIDProviderKeyGracePeriod = time.Hour
+	options.AppSettings.OpenIDProviderOnDemandTimeout = 0
+
+	kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+	kl.refreshKeys()
+	kid = "new"
+	kl.refreshKeys()
+
+	if _, err := kl.LoadIssuerJWK("PlanB", "old"); err != nil {
+		t.Error("Retired key `old` should still be accepted during the grace period: ", err)
+	}
+	if _, has := kl.Keys()["old"]; has {
+		t.Error("Retired key `old` should not be published")
+	}
+	if _, has := kl.Keys()["new"]; !has {
+		t.Error("Key `new` should be published")
+	}
+
+	kl.mu.Lock()
+	kl.retired["old"] = retiredKey{key: kl.retired["old"].key, retiredAt: time.Now().Add(-2 * time.Hour)}
+	kl.mu.Unlock()
+	if _, err := kl.LoadKey("old"); err == nil {
+		t.Error("Retired key `old` should not be accepted after the grace period")
+	}
+
+	kl.refreshKeys()
+	if len(kl.retired) != 0 {
+		t.Errorf("Retired keys should be removed after the grace period, got %v", kl.retired)
+	}
+
+	options.AppSettings.OpenIDProviderKeyGracePeriod = 0
+	kid = "newer"
+	kl.refreshKeys()
+	if _, err := kl.LoadKey("new"); err == nil {
+		t.Error("Without a grace period, keys should be removed immediately")
+	}
+}
+
+func TestKeyReplacement(t *testing.T) {
+	var (
+		listener string
+		key      string
+	)
+	original := `{"kid": "testkey", "kty": "EC", "crv": "P-256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}`
+	withAlg := `{"kid": "testkey", "kty": "EC", "crv": "P-256", "alg": "ES256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}`
+	replacement := `{"kid": "testkey", "kty": "EC", "crv": "P-256", "x": "FDrM1mhj9Q4gvELNEVSe6UPKNjjVuAtgt04ro9dCchU", "y": "HTGUAM_1N_9bDYOW2W_nRDX64JXw41ja6DxpbSPaEsA"}`
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+			return
+		}
+		fmt.Fprintf(w, `{"keys": [%s]}`, key)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	listener = server.URL
+
+	defer func(refuse bool) { options.AppSettings.OpenIDRefuseKeyReplacement = refuse }(options.AppSettings.OpenIDRefuseKeyReplacement)
+	count := func(name string) int64 {
+		return metrics.GetOrRegisterCounter(name, metrics.DefaultRegistry).Count()
+	}
+	x := func(kl *cachingOpenIDProviderLoader) string {
+		k, _ := kl.LoadKey("testkey")
+		return k.(*ecdsa.PublicKey).X.String()
+	}
+
+	for _, refuse := range []bool{false, true} {
+		options.AppSettings.OpenIDRefuseKeyReplacement = refuse
+		replaced, refused := count(metricsKeyReplaced), count(metricsKeyReplacementRefused)
+
+		kl := &cachingOpenIDProviderLoader{url: listener + "/.well-known/openid-configuration", keyCache: caching.NewCache()}
+		key = original
+		kl.refreshKeys()
+		before := x(kl)
+
+		key = withAlg
+		kl.refreshKeys()
+		if got := count(metricsKeyReplaced) - replaced; got != 0 {
+			t.Errorf("New parameters of the same key material are not a replacement. Got %d replacements", got)
+		}
+
+		key = replacement
+		kl.refreshKeys()
+		if got := count(metricsKeyReplaced) - replaced; got != 1 {
+			t.Errorf("Wrong number of key replacements. Wanted 1, got %d", got)
+		}
+
+		after := x(kl)
+		if refuse {
+			if after != before {
+				t.Error("The replacement of the key should have been refused")
+			}
+			if got := count(metricsKeyReplacementRefused) - refused; got != 1 {
+				t.Errorf("Wrong number of refused key replacements. Wanted 1, got %d", got)
+			}
+		} else if after == before {
+			t.Error("The key should have been replaced")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package openid
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+	"github.com/zalando/planb-tokeninfo/options"
+	"github.com/zalando/planb-tokeninfo/snapshot"
+)
+
+const metricsSnapshotError = "planb.openidprovider.errors.snapshot"
+
+// keysSnapshot holds the keys of a provider that were last accepted in the key cache. It allows starting with keys
+// while the provider is not reachable. The raw JWKS isn't stored, as it may hold keys that were rejected or whose
+// replacement was refused
+type keysSnapshot struct {
+	URL    string          `json:"url"`
+	Issuer string          `json:"issuer"`
+	JWKS   json.RawMessage `json:"jwks"`
+}
+
+// snapshotPath returns the path of the snapshot file of the provider or an empty string if snapshots are disabled
+func (kl *cachingOpenIDProviderLoader) snapshotPath() string {
+	if options.AppSettings.SnapshotDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(kl.url))
+	return filepath.Join(options.AppSettings.SnapshotDir, "jwks-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// saveSnapshot stores the keys currently in the key cache
+func (kl *cachingOpenIDProviderLoader) saveSnapshot(issuer string) {
+	path := kl.snapshotPath()
+	if path == "" {
+		return
+	}
+	keys := new(jwk.JSONWebKeySet)
+	for _, k := range kl.keyCache.Snapshot() {
+		keys.Keys = append(keys.Keys, k.(jwk.JSONWebKey))
+	}
+	sort.Slice(keys.Keys, func(i, j int) bool { return keys.Keys[i].KeyID < keys.Keys[j].KeyID })
+	jwks, err := json.Marshal(keys)
+	if err != nil {
+		log.Printf("Failed to encode the keys snapshot %q: %v\n", path, err)
+		incCounter(metricsSnapshotError)
+		return
+	}
+	if err = snapshot.Save(path, &keysSnapshot{URL: kl.url, Issuer: issuer, JWKS: jwks}); err != nil {
+		log.Printf("Failed to save the keys snapshot %q: %v\n", path, err)
+		incCounter(metricsSnapshotError)
+	}
+}
+
+// loadSnapshot fills the key cache from the snapshot of the provider, unless it is older than SnapshotMaxAge
+func (kl *cachingOpenIDProviderLoader) loadSnapshot() {
+	path := kl.snapshotPath()
+	if path == "" {
+		return
+	}
+	s := new(keysSnapshot)
+	savedAt, err := snapshot.Load(path, options.AppSettings.SnapshotMaxAge, s)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Ignoring the keys snapshot %q: %v\n", path, err)
+		incCounter(metricsSnapshotError)
+		return
+	}
+	if s.URL != kl.url {
+		log.Printf("Ignoring the keys snapshot %q of another provider %q\n", path, s.URL)
+		return
+	}
+	log.Printf("Loading keys from the snapshot %q saved at %v..\n", path, savedAt)
+	kl.setIssuer(s.Issuer)
+	kl.updateKeys(s.JWKS)
+}
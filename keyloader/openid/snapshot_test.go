@@ -0,0 +1,105 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestKeysSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string, maxAge time.Duration) {
+		options.AppSettings.SnapshotDir = dir
+		options.AppSettings.SnapshotMaxAge = maxAge
+	}(options.AppSettings.SnapshotDir, options.AppSettings.SnapshotMaxAge)
+	options.AppSettings.SnapshotDir = dir
+	options.AppSettings.SnapshotMaxAge = time.Hour
+
+	server := newProviderServer("PlanB", "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs")
+	u, _ := url.Parse(server.URL + "/.well-known/openid-configuration")
+	newCachingOpenIDProviderLoader(u, time.Minute).refreshKeys()
+	server.Close()
+
+	kl := newCachingOpenIDProviderLoader(u, time.Minute)
+	if _, err := kl.LoadIssuerJWK("PlanB", "testkey"); err != nil {
+		t.Error("Key `testkey` should have been loaded from the snapshot: ", err)
+	}
+	if kl.Issuer() != "PlanB" {
+		t.Errorf("The issuer should have been loaded from the snapshot. Got %q", kl.Issuer())
+	}
+
+	other, _ := url.Parse("http://other.example.org/.well-known/openid-configuration")
+	if len(newCachingOpenIDProviderLoader(other, time.Minute).Keys()) != 0 {
+		t.Error("Snapshots should not be shared between providers")
+	}
+
+	options.AppSettings.SnapshotMaxAge = -time.Second
+	if len(newCachingOpenIDProviderLoader(u, time.Minute).Keys()) != 0 {
+		t.Error("Snapshots older than the maximum age should be ignored")
+	}
+}
+
+func TestKeysSnapshotRefusedReplacement(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string, maxAge time.Duration, refuse bool) {
+		options.AppSettings.SnapshotDir = dir
+		options.AppSettings.SnapshotMaxAge = maxAge
+		options.AppSettings.OpenIDRefuseKeyReplacement = refuse
+	}(options.AppSettings.SnapshotDir, options.AppSettings.SnapshotMaxAge, options.AppSettings.OpenIDRefuseKeyReplacement)
+	options.AppSettings.SnapshotDir = dir
+	options.AppSettings.SnapshotMaxAge = time.Hour
+	options.AppSettings.OpenIDRefuseKeyReplacement = true
+
+	var listener, x, y string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/.well-known/openid-configuration" {
+			fmt.Fprintf(w, `{"issuer": "PlanB", "jwks_uri": "%s/oauth2/v3/certs"}`, listener)
+			return
+		}
+		fmt.Fprintf(w, `{"keys": [{"alg": "ES256", "crv": "P-256", "kid": "testkey", "kty": "EC", "use": "sig", "x": "%s", "y": "%s"}]}`, x, y)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	listener = server.URL
+	u, _ := url.Parse(server.URL + "/.well-known/openid-configuration")
+
+	kl := newCachingOpenIDProviderLoader(u, time.Minute)
+	x, y = "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"
+	kl.refreshKeys()
+	original, err := kl.LoadKey("testkey")
+	if err != nil {
+		t.Fatal("Key `testkey` should have been loaded: ", err)
+	}
+	x, y = "FDrM1mhj9Q4gvELNEVSe6UPKNjjVuAtgt04ro9dCchU", "HTGUAM_1N_9bDYOW2W_nRDX64JXw41ja6DxpbSPaEsA"
+	kl.refreshKeys()
+	server.Close()
+
+	restarted := newCachingOpenIDProviderLoader(u, time.Minute)
+	k, err := restarted.LoadIssuerJWK("PlanB", "testkey")
+	if err != nil {
+		t.Fatal("Key `testkey` should have been loaded from the snapshot: ", err)
+	}
+	if k.Key.(*ecdsa.PublicKey).X.Cmp(original.(*ecdsa.PublicKey).X) != 0 {
+		t.Error("The snapshot should keep the original key after its replacement was refused")
+	}
+	if k.Algorithm != "ES256" || k.Use != "sig" {
+		t.Errorf("The parameters of the key should have been kept in the snapshot. Got %q/%q", k.Algorithm, k.Use)
+	}
+}
@@ -0,0 +1,36 @@
+package static
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+)
+
+// NewFileLoader returns a JWKLoader with the keys from the JSON Web Key Set in the file at path. The file
+// is checked for changes every interval. The keys are only used for tokens of the issuer, unless it is empty
+func NewFileLoader(path string, issuer string, interval time.Duration) (keyloader.JWKLoader, error) {
+	stat := func() (string, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size()), nil
+	}
+	read := func() (map[string]interface{}, error) {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		jwks := new(jwk.JSONWebKeySet)
+		if err = json.Unmarshal(buf, jwks); err != nil {
+			return nil, err
+		}
+		return jwks.ToMap(), nil
+	}
+	return newStaticLoader(path, issuer, interval, stat, read)
+}
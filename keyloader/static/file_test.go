@@ -0,0 +1,63 @@
+package static
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/keyloader"
+)
+
+func init() {
+	scheduleFunc = noOpScheduler
+}
+
+func noOpScheduler(_ time.Duration, _ keyloader.JobFunc) {}
+
+const testJWKS = `{"keys": [{"kid": "%s", "kty": "EC", "crv": "P-256", "alg": "ES256", "x": "_5Z_cB5zhjVCt_GMfiC6sSBos0podt-YJicV6_GzDD0", "y": "02LHDzZYup0SlbuqjNPBhr2X_LGamSgRidzKXsA0TFs"}]}`
+
+func TestFileLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+
+	if _, err = NewFileLoader(path, "", time.Minute); err == nil {
+		t.Error("Missing files should fail")
+	}
+
+	ioutil.WriteFile(path, []byte(fmt.Sprintf(testJWKS, "testkey")), 0644)
+	kl, err := NewFileLoader(path, "PlanB", time.Minute)
+	if err != nil {
+		t.Fatal("Failed to load the JWKS file: ", err)
+	}
+	if k, err := kl.LoadIssuerJWK("PlanB", "testkey"); err != nil || k.Algorithm != "ES256" {
+		t.Errorf("Unexpected key `testkey`: %+v, %v", k, err)
+	}
+	if _, err = kl.LoadIssuerKey("Other", "testkey"); err != keyloader.ErrIssuerMismatch {
+		t.Errorf("Keys should only be used for their issuer. Wanted %v, got %v", keyloader.ErrIssuerMismatch, err)
+	}
+	if issuers := kl.Issuers(); len(issuers) != 1 || issuers[0] != "PlanB" {
+		t.Errorf("Unexpected issuers %v", issuers)
+	}
+
+	ioutil.WriteFile(path, []byte(fmt.Sprintf(testJWKS, "newerkey")), 0644)
+	kl.(*staticLoader).refresh()
+	if _, err = kl.LoadKey("newerkey"); err != nil {
+		t.Error("Changed files should be reloaded: ", err)
+	}
+	if _, err = kl.LoadKey("testkey"); err == nil {
+		t.Error("Keys removed from the file should be removed")
+	}
+
+	ioutil.WriteFile(path, []byte(`{"keys": [`), 0644)
+	kl.(*staticLoader).refresh()
+	if _, err = kl.LoadKey("newerkey"); err != nil {
+		t.Error("Invalid files should not replace the current keys: ", err)
+	}
+}
@@ -0,0 +1,148 @@
+package static
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/caching"
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+const (
+	metricsNumKeys         = "planb.staticloader.numkeys"
+	metricsReloadError     = "planb.staticloader.errors.reload"
+	metricsInvalidKeyError = "planb.staticloader.errors.invalidkey"
+)
+
+var (
+	// ErrNoKeys is returned when the source has no valid keys
+	ErrNoKeys = errors.New("No valid keys")
+
+	scheduleFunc = keyloader.Schedule
+)
+
+// staticLoader holds keys read from local files. The files are checked for changes in regular intervals
+// and the keys are replaced when they change. Without an issuer, the keys are used for any issuer
+type staticLoader struct {
+	source   string
+	issuer   string
+	keyCache *caching.Cache
+	stat     func() (string, error)
+	read     func() (map[string]interface{}, error)
+	mu       sync.Mutex
+	version  string
+}
+
+func newStaticLoader(source string, issuer string, interval time.Duration, stat func() (string, error), read func() (map[string]interface{}, error)) (*staticLoader, error) {
+	l := &staticLoader{source: source, issuer: issuer, keyCache: caching.NewCache(), stat: stat, read: read}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	scheduleFunc(interval, l.refresh)
+	return l, nil
+}
+
+// refresh reloads the keys if the files changed. On errors, the current keys are kept
+func (l *staticLoader) refresh() {
+	if err := l.reload(); err != nil {
+		log.Printf("Failed to reload the keys from %s: %v\n", l.source, err)
+		if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsReloadError, metrics.NewCounter).(metrics.Counter); ok {
+			c.Inc(1)
+		}
+	}
+}
+
+func (l *staticLoader) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	version, err := l.stat()
+	if err != nil {
+		return err
+	}
+	if version == l.version {
+		return nil
+	}
+
+	keys, err := l.read()
+	if err != nil {
+		return err
+	}
+	for kid, k := range keys {
+		key := k.(jwk.JSONWebKey)
+		err := key.Validate(options.AppSettings.JWKSMinRSAKeySize)
+		if err == nil {
+			err = key.VerifyCertificates(options.AppSettings.JWKSRootCAs, time.Now())
+		}
+		if err != nil {
+			log.Printf("Rejecting invalid public key %q from %s: %v\n", kid, l.source, err)
+			if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsInvalidKeyError, metrics.NewCounter).(metrics.Counter); ok {
+				c.Inc(1)
+			}
+			delete(keys, kid)
+		}
+	}
+	if len(keys) < 1 {
+		return ErrNoKeys
+	}
+
+	log.Printf("Loaded %d key(s) from %s\n", len(keys), l.source)
+	l.keyCache.Reset(keys)
+	l.version = version
+	if g, ok := metrics.DefaultRegistry.GetOrRegister(metricsNumKeys, metrics.NewGauge).(metrics.Gauge); ok {
+		g.Update(int64(len(keys)))
+	}
+	return nil
+}
+
+func (l *staticLoader) LoadKey(id string) (interface{}, error) {
+	v := l.keyCache.Get(id)
+	if v == nil {
+		return nil, fmt.Errorf("Key '%s' not found", id)
+	}
+	return v.(jwk.JSONWebKey).Key, nil
+}
+
+// Keys returns the current keys, named by keyloader.KeyName
+func (l *staticLoader) Keys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	for kid, k := range l.keyCache.Snapshot() {
+		keys[keyloader.KeyName(l.issuer, kid)] = k
+	}
+	return keys
+}
+
+// LoadIssuerKey returns the key with the id if the loader has no issuer or if the issuer matches
+func (l *staticLoader) LoadIssuerKey(issuer string, id string) (interface{}, error) {
+	k, err := l.LoadIssuerJWK(issuer, id)
+	if err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+// LoadIssuerJWK is like LoadIssuerKey but returns the whole JWK, including its algorithm and use
+func (l *staticLoader) LoadIssuerJWK(issuer string, id string) (jwk.JSONWebKey, error) {
+	v := l.keyCache.Get(id)
+	if v == nil {
+		return jwk.JSONWebKey{}, fmt.Errorf("Key '%s' not found", id)
+	}
+	if l.issuer != "" && l.issuer != issuer {
+		return jwk.JSONWebKey{}, keyloader.ErrIssuerMismatch
+	}
+	return v.(jwk.JSONWebKey), nil
+}
+
+// Issuers returns the issuer of the keys, if any
+func (l *staticLoader) Issuers() []string {
+	if l.issuer != "" {
+		return []string{l.issuer}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package static
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/keyloader"
+	"github.com/zalando/planb-tokeninfo/keyloader/openid/jwk"
+)
+
+// NewPEMDirLoader returns a JWKLoader with the public keys from the .pem files in the directory dir. Each file
+// holds one PUBLIC KEY, RSA PUBLIC KEY or CERTIFICATE block and the file name, without the extension, is the key
+// ID. The directory is checked for changes every interval. The keys are only used for tokens of the issuer,
+// unless it is empty
+func NewPEMDirLoader(dir string, issuer string, interval time.Duration) (keyloader.JWKLoader, error) {
+	stat := func() (string, error) {
+		files, err := pemFiles(dir)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		for _, fi := range files {
+			fmt.Fprintf(&b, "%s/%d/%d;", fi.name, fi.modTime, fi.size)
+		}
+		return b.String(), nil
+	}
+	read := func() (map[string]interface{}, error) {
+		files, err := pemFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		keys := make(map[string]interface{})
+		for _, fi := range files {
+			k, err := readPEMKey(filepath.Join(dir, fi.name))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", fi.name, err)
+			}
+			k.KeyID = strings.TrimSuffix(fi.name, filepath.Ext(fi.name))
+			keys[k.KeyID] = k
+		}
+		return keys, nil
+	}
+	return newStaticLoader(dir, issuer, interval, stat, read)
+}
+
+type pemFile struct {
+	name    string
+	modTime int64
+	size    int64
+}
+
+// pemFiles lists the .pem files in dir, sorted by name
+func pemFiles(dir string) ([]pemFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []pemFile
+	for _, fi := range infos {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".pem" {
+			continue
+		}
+		files = append(files, pemFile{name: fi.Name(), modTime: fi.ModTime().UnixNano(), size: fi.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// readPEMKey reads the key of a .pem file. PEM files can't tell the use and algorithm of the key, so the key is
+// published for signatures with the algorithm derived from its type. See pemAlgorithm
+func readPEMKey(path string) (jwk.JSONWebKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return jwk.JSONWebKey{}, err
+	}
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return jwk.JSONWebKey{}, fmt.Errorf("No PEM block found")
+	}
+	k := jwk.JSONWebKey{Use: "sig"}
+	switch block.Type {
+	case "PUBLIC KEY":
+		k.Key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		k.Key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return jwk.JSONWebKey{}, err
+		}
+		k.Key, k.Certificates = cert.PublicKey, []*x509.Certificate{cert}
+	default:
+		return jwk.JSONWebKey{}, fmt.Errorf("Unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return jwk.JSONWebKey{}, err
+	}
+	k.Algorithm = pemAlgorithm(k.Key)
+	return k, nil
+}
+
+// pemAlgorithm returns the signing algorithm of the key: RS256 for RSA keys, ES256, ES384 or ES512 depending on
+// the curve of ECDSA keys and EdDSA for Ed25519 keys. Other algorithms, like PS256, need JWT_LENIENT_KEY_BINDING
+func pemAlgorithm(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return "ES256"
+		case 384:
+			return "ES384"
+		case 521:
+			return "ES512"
+		}
+	case ed25519.PublicKey:
+		return "EdDSA"
+	}
+	return ""
+}
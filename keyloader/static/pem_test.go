@@ -0,0 +1,85 @@
+package static
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPEMDirLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, blockType string, der []byte) {
+		buf := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := ioutil.WriteFile(filepath.Join(dir, name), buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	write("ec.pem", "PUBLIC KEY", der)
+
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ = x509.MarshalPKIXPublicKey(edKey)
+	write("ed.pem", "PUBLIC KEY", der)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	write("rsa.pem", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, _ = x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ecKey.PublicKey, ecKey)
+	write("cert.pem", "CERTIFICATE", der)
+
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0644)
+
+	kl, err := NewPEMDirLoader(dir, "", time.Minute)
+	if err != nil {
+		t.Fatal("Failed to load the PEM files: ", err)
+	}
+	if n := len(kl.Keys()); n != 4 {
+		t.Errorf("Wrong number of keys. Wanted 4, got %d", n)
+	}
+	algs := map[string]string{"ec": "ES256", "ed": "EdDSA", "rsa": "RS256", "cert": "ES256"}
+	for kid, want := range map[string]interface{}{"ec": &ecKey.PublicKey, "ed": edKey, "rsa": &rsaKey.PublicKey, "cert": &ecKey.PublicKey} {
+		k, err := kl.LoadIssuerJWK("any", kid)
+		if err != nil {
+			t.Errorf("Failed to load key %q: %v", kid, err)
+			continue
+		}
+		if k.KeyID != kid {
+			t.Errorf("Wrong key ID. Wanted %q, got %q", kid, k.KeyID)
+		}
+		if k.Use != "sig" || k.Algorithm != algs[kid] {
+			t.Errorf("Wrong use and algorithm of key %q. Wanted sig/%s, got %s/%s", kid, algs[kid], k.Use, k.Algorithm)
+		}
+		if eq, ok := k.Key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !eq.Equal(want) {
+			t.Errorf("Wrong key %q", kid)
+		}
+	}
+
+	write("bad.pem", "PRIVATE KEY", []byte("foo"))
+	kl.(*staticLoader).refresh()
+	if n := len(kl.Keys()); n != 4 {
+		t.Errorf("Invalid files should not replace the current keys, got %d keys", n)
+	}
+
+	if _, err = NewPEMDirLoader(filepath.Join(dir, "missing"), "", time.Minute); err == nil {
+		t.Error("Missing directories should fail")
+	}
+}
@@ -1,10 +1,13 @@
 package options
 
 import (
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zalando/planb-tokeninfo/processor"
@@ -20,14 +23,49 @@ type Settings struct {
 	UpstreamCacheTTL                  time.Duration
 	OpenIDProviderConfigurationURL    *url.URL
 	OpenIDProviderRefreshInterval     time.Duration
+	OpenIDProviderOnDemandInterval    time.Duration
+	OpenIDProviderOnDemandTimeout     time.Duration
+	OpenIDProviderMinRefreshInterval  time.Duration
+	OpenIDProviderMaxRefreshInterval  time.Duration
+	OpenIDProviderKeyGracePeriod      time.Duration
+	OpenIDRefuseKeyReplacement        bool
+	AdditionalOpenIDProviders         []OpenIDProvider
 	HTTPClientTimeout                 time.Duration
 	HTTPClientTLSTimeout              time.Duration
 	RevocationCacheTTL                time.Duration
 	RevocationProviderRefreshInterval time.Duration
 	RevocationRefreshTolerance        time.Duration
 	RevocationProviderUrl             *url.URL
+	RevocationStreamURL               *url.URL
 	HashingSalt                       string
+	AdditionalHashingSalts            []string
+	RefuseDefaultHashingSalt          bool
+	AllowedAudiences                  []string
+	JwtLeeway                         time.Duration
+	AllowedAlgorithms                 []string
+	LenientKeyBinding                 bool
+	JWKSRootCAs                       *x509.CertPool
+	JWKSMinRSAKeySize                 int
+	ExposedClaims                     []string
+	ErrorReasons                      bool
+	IntrospectionClients              map[string]string
+	AdminListenAddress                string
+	AdminCredentials                  map[string]string
+	BatchMaxSize                      int
 	JwtProcessors                     map[string]processor.JwtProcessor
+	SnapshotDir                       string
+	SnapshotMaxAge                    time.Duration
+	KeySources                        []string
+	JWKSFile                          string
+	PEMKeysDir                        string
+	StaticKeysIssuer                  string
+	StaticKeysRefreshInterval         time.Duration
+}
+
+// The OpenIDProvider type holds the options of one of the trusted OpenID providers
+type OpenIDProvider struct {
+	ConfigurationURL *url.URL
+	RefreshInterval  time.Duration
 }
 
 const (
@@ -37,12 +75,27 @@ const (
 	defaultUpstreamCacheTTL              = 60 * time.Second
 	defaultUpstreamTimeout               = 1 * time.Second
 	defaultOpenIDRefreshInterval         = 30 * time.Second
+	defaultOpenIDOnDemandInterval        = 10 * time.Second
+	defaultOpenIDOnDemandTimeout         = 1 * time.Second
+	defaultOpenIDMinRefreshInterval      = 5 * time.Second
+	defaultOpenIDMaxRefreshInterval      = 5 * time.Minute
 	defaultHTTPClientTimeout             = 10 * time.Second
 	defaultHTTPClientTLSTimeout          = 10 * time.Second
 	defaultRevocationCacheTTL            = 30 * 24 * time.Hour
 	defaultRevokeProviderRefreshInterval = 10 * time.Second
 	defaultRevocationRereshTolerance     = 60 * time.Second
 	defaultHashingSalt                   = "seasaltisthebest"
+	defaultBatchMaxSize                  = 100
+	defaultJWKSMinRSAKeySize             = 2048
+	defaultSnapshotMaxAge                = 24 * time.Hour
+	defaultStaticKeysRefreshInterval     = 10 * time.Second
+
+	// KeySourceOpenID selects the keys of the OpenID providers
+	KeySourceOpenID = "openid"
+	// KeySourceJWKSFile selects the keys from the JWKS_FILE
+	KeySourceJWKSFile = "jwks_file"
+	// KeySourcePEMDir selects the keys from the PEM files in the PEM_KEYS_DIR
+	KeySourcePEMDir = "pem_dir"
 )
 
 var (
@@ -58,14 +111,49 @@ func defaultSettings() *Settings {
 		UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
 		UpstreamTimeout:                   defaultUpstreamTimeout,
 		OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+		OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+		OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+		OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+		OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 		HTTPClientTimeout:                 defaultHTTPClientTimeout,
 		HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 		RevocationCacheTTL:                defaultRevocationCacheTTL,
 		RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 		RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
 		HashingSalt:                       defaultHashingSalt,
+		JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+		BatchMaxSize:                      defaultBatchMaxSize,
 		JwtProcessors:                     make(map[string]processor.JwtProcessor),
+		SnapshotMaxAge:                    defaultSnapshotMaxAge,
+		StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+	}
+}
+
+// OpenIDProviders returns all the trusted OpenID providers. The first one is always the provider
+// from OpenIDProviderConfigurationURL, followed by the AdditionalOpenIDProviders
+func (s *Settings) OpenIDProviders() []OpenIDProvider {
+	providers := []OpenIDProvider{{ConfigurationURL: s.OpenIDProviderConfigurationURL, RefreshInterval: s.OpenIDProviderRefreshInterval}}
+	return append(providers, s.AdditionalOpenIDProviders...)
+}
+
+// UsesDefaultHashingSalt returns true if the revocations are hashed with the built-in default salt, which is
+// public and should not be used in production
+func (s *Settings) UsesDefaultHashingSalt() bool {
+	return s.HashingSalt == defaultHashingSalt
+}
+
+// UsesKeySource returns true if the keys are loaded from the source. Without KeySources, only the OpenID
+// providers are used
+func (s *Settings) UsesKeySource(source string) bool {
+	if len(s.KeySources) == 0 {
+		return source == KeySourceOpenID
+	}
+	for _, ks := range s.KeySources {
+		if ks == source {
+			return true
+		}
 	}
+	return false
 }
 
 // LoadFromEnvironment will try to load all the options from environment variables.
@@ -76,10 +164,41 @@ func defaultSettings() *Settings {
 //      OPENID_PROVIDER_CONFIGURATION_URL
 //	REVOCATION_PROVIDER_URL
 //
-// The remaining options have sane defaults and are not mandatory
+// The remaining options have sane defaults and are not mandatory. OPENID_PROVIDER_CONFIGURATION_URL is
+// not required if KEY_SOURCES doesn't include the OpenID providers
 func LoadFromEnvironment() error {
 	settings := defaultSettings()
 
+	if s := getString("KEY_SOURCES", ""); s != "" {
+		settings.KeySources = getList(s)
+		for _, ks := range settings.KeySources {
+			if ks != KeySourceOpenID && ks != KeySourceJWKSFile && ks != KeySourcePEMDir {
+				return fmt.Errorf("Invalid KEY_SOURCES: unknown key source %q\n", ks)
+			}
+		}
+	}
+
+	settings.JWKSFile = getString("JWKS_FILE", "")
+	if settings.UsesKeySource(KeySourceJWKSFile) && settings.JWKSFile == "" {
+		return fmt.Errorf("Invalid JWKS_FILE: required by KEY_SOURCES\n")
+	}
+
+	settings.PEMKeysDir = getString("PEM_KEYS_DIR", "")
+	if settings.UsesKeySource(KeySourcePEMDir) && settings.PEMKeysDir == "" {
+		return fmt.Errorf("Invalid PEM_KEYS_DIR: required by KEY_SOURCES\n")
+	}
+
+	settings.StaticKeysIssuer = getString("STATIC_KEYS_ISSUER", "")
+	// otherwise the static keys would accept tokens of any issuer, including the ones of the OpenID providers
+	if settings.StaticKeysIssuer == "" && settings.UsesKeySource(KeySourceOpenID) &&
+		(settings.UsesKeySource(KeySourceJWKSFile) || settings.UsesKeySource(KeySourcePEMDir)) {
+		return fmt.Errorf("Invalid STATIC_KEYS_ISSUER: required when KEY_SOURCES combines static keys with openid\n")
+	}
+
+	if d := getDuration("STATIC_KEYS_REFRESH_INTERVAL", 0); d > 0 {
+		settings.StaticKeysRefreshInterval = d
+	}
+
 	if s := getString("UPSTREAM_TOKENINFO_URL", ""); s != "" {
 		tokeninfoURL, err := getURL("UPSTREAM_TOKENINFO_URL")
 		if err != nil {
@@ -89,7 +208,7 @@ func LoadFromEnvironment() error {
 	}
 
 	openIDConfiguration, err := getURL("OPENID_PROVIDER_CONFIGURATION_URL")
-	if err != nil || openIDConfiguration == nil {
+	if settings.UsesKeySource(KeySourceOpenID) && (err != nil || openIDConfiguration == nil) {
 		return fmt.Errorf("Invalid OPENID_PROVIDER_CONFIGURATION_URL: %v\n", err)
 	}
 	settings.OpenIDProviderConfigurationURL = openIDConfiguration
@@ -100,10 +219,98 @@ func LoadFromEnvironment() error {
 	}
 	settings.RevocationProviderUrl = revocationURL
 
+	if s := getString("REVOCATION_STREAM_URL", ""); s != "" {
+		streamURL, err := getURL("REVOCATION_STREAM_URL")
+		if err != nil {
+			return fmt.Errorf("Invalid REVOCATION_STREAM_URL: %v\n", err)
+		}
+		settings.RevocationStreamURL = streamURL
+	}
+
 	if s := getString("REVOCATION_HASHING_SALT", ""); s != "" {
 		settings.HashingSalt = s
 	}
 
+	if s := getString("REVOCATION_ADDITIONAL_HASHING_SALTS", ""); s != "" {
+		settings.AdditionalHashingSalts = getList(s)
+	}
+
+	settings.RefuseDefaultHashingSalt = getBool("REVOCATION_REFUSE_DEFAULT_SALT", false)
+	if settings.RefuseDefaultHashingSalt && settings.UsesDefaultHashingSalt() {
+		return fmt.Errorf("Invalid REVOCATION_HASHING_SALT: the built-in default salt is not allowed\n")
+	}
+
+	if s := getString("ALLOWED_AUDIENCES", ""); s != "" {
+		settings.AllowedAudiences = getList(s)
+	}
+
+	if d := getDuration("JWT_LEEWAY", -1); d > -1 {
+		settings.JwtLeeway = d
+	}
+
+	if s := getString("JWT_ALLOWED_ALGORITHMS", ""); s != "" {
+		settings.AllowedAlgorithms = getList(s)
+	}
+
+	settings.LenientKeyBinding = getBool("JWT_LENIENT_KEY_BINDING", false)
+
+	if s := getString("JWKS_CA_BUNDLE", ""); s != "" {
+		roots, err := loadCertPool(s)
+		if err != nil {
+			return fmt.Errorf("Invalid JWKS_CA_BUNDLE: %v\n", err)
+		}
+		settings.JWKSRootCAs = roots
+	}
+
+	if i := getInt("JWKS_MIN_RSA_KEY_SIZE", -1); i > 0 {
+		settings.JWKSMinRSAKeySize = i
+	}
+
+	if s := getString("JWT_EXPOSED_CLAIMS", ""); s != "" {
+		settings.ExposedClaims = getList(s)
+	}
+
+	settings.ErrorReasons = getBool("ERROR_REASONS", false)
+
+	if s := getString("INTROSPECTION_CLIENT_CREDENTIALS", ""); s != "" {
+		clients, err := parseClientCredentials(s)
+		if err != nil {
+			return fmt.Errorf("Invalid INTROSPECTION_CLIENT_CREDENTIALS: %v\n", err)
+		}
+		settings.IntrospectionClients = clients
+	}
+
+	if s := getString("ADMIN_CREDENTIALS", ""); s != "" {
+		credentials, err := parseClientCredentials(s)
+		if err != nil {
+			return fmt.Errorf("Invalid ADMIN_CREDENTIALS: %v\n", err)
+		}
+		settings.AdminCredentials = credentials
+	}
+
+	if s := getString("JWT_PROCESSORS_CONFIG", ""); s != "" {
+		processors, err := processor.LoadConfigFile(s)
+		if err != nil {
+			return fmt.Errorf("Invalid JWT_PROCESSORS_CONFIG: %v\n", err)
+		}
+		settings.JwtProcessors = processors
+	}
+
+	if s := getString("SNAPSHOT_DIR", ""); s != "" {
+		if fi, err := os.Stat(s); err != nil || !fi.IsDir() {
+			return fmt.Errorf("Invalid SNAPSHOT_DIR: %q is not a directory\n", s)
+		}
+		settings.SnapshotDir = s
+	}
+
+	if d := getDuration("SNAPSHOT_MAX_AGE", 0); d > 0 {
+		settings.SnapshotMaxAge = d
+	}
+
+	if i := getInt("BATCH_MAX_SIZE", -1); i > 0 {
+		settings.BatchMaxSize = i
+	}
+
 	if s := getString("LISTEN_ADDRESS", ""); s != "" {
 		settings.ListenAddress = s
 	}
@@ -112,6 +319,16 @@ func LoadFromEnvironment() error {
 		settings.MetricsListenAddress = s
 	}
 
+	if s := getString("ADMIN_LISTEN_ADDRESS", ""); s != "" {
+		if s == settings.ListenAddress || s == settings.MetricsListenAddress {
+			return fmt.Errorf("Invalid ADMIN_LISTEN_ADDRESS: it must be different from the other listeners\n")
+		}
+		if len(settings.AdminCredentials) == 0 {
+			return fmt.Errorf("Invalid ADMIN_LISTEN_ADDRESS: ADMIN_CREDENTIALS are required\n")
+		}
+		settings.AdminListenAddress = s
+	}
+
 	if i := getInt("UPSTREAM_CACHE_MAX_SIZE", -1); i > -1 {
 		settings.UpstreamCacheMaxSize = int64(i)
 	}
@@ -128,6 +345,40 @@ func LoadFromEnvironment() error {
 		settings.OpenIDProviderRefreshInterval = d
 	}
 
+	if d := getDuration("OPENID_PROVIDER_ON_DEMAND_INTERVAL", 0); d > 0 {
+		settings.OpenIDProviderOnDemandInterval = d
+	}
+
+	if d := getDuration("OPENID_PROVIDER_ON_DEMAND_TIMEOUT", -1); d > -1 {
+		settings.OpenIDProviderOnDemandTimeout = d
+	}
+
+	if d := getDuration("OPENID_PROVIDER_MIN_REFRESH_INTERVAL", 0); d > 0 {
+		settings.OpenIDProviderMinRefreshInterval = d
+	}
+
+	if d := getDuration("OPENID_PROVIDER_MAX_REFRESH_INTERVAL", 0); d > 0 {
+		settings.OpenIDProviderMaxRefreshInterval = d
+	}
+
+	if d := getDuration("OPENID_PROVIDER_KEY_GRACE_PERIOD", 0); d > 0 {
+		settings.OpenIDProviderKeyGracePeriod = d
+	}
+
+	settings.OpenIDRefuseKeyReplacement = getBool("OPENID_PROVIDER_REFUSE_KEY_REPLACEMENT", false)
+
+	if settings.OpenIDProviderMinRefreshInterval > settings.OpenIDProviderMaxRefreshInterval {
+		return fmt.Errorf("Invalid OPENID_PROVIDER_MIN_REFRESH_INTERVAL: greater than OPENID_PROVIDER_MAX_REFRESH_INTERVAL\n")
+	}
+
+	if s := getString("OPENID_ADDITIONAL_PROVIDERS", ""); s != "" {
+		providers, err := parseOpenIDProviders(s, settings.OpenIDProviderRefreshInterval)
+		if err != nil {
+			return fmt.Errorf("Invalid OPENID_ADDITIONAL_PROVIDERS: %v\n", err)
+		}
+		settings.AdditionalOpenIDProviders = providers
+	}
+
 	if d := getDuration("HTTP_CLIENT_TIMEOUT", 0); d > 0 {
 		settings.HTTPClientTimeout = d
 	}
@@ -152,6 +403,50 @@ func LoadFromEnvironment() error {
 	return nil
 }
 
+// parseOpenIDProviders parses a comma separated list of OpenID configuration URLs. Each URL can be
+// followed by a space and a custom refresh interval for that provider. Ex.:
+//
+//	https://idp1.example.org/.well-known/openid-configuration 1m,https://idp2.example.org/.well-known/openid-configuration
+func parseOpenIDProviders(s string, defaultInterval time.Duration) ([]OpenIDProvider, error) {
+	var providers []OpenIDProvider
+	for _, entry := range strings.Split(s, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("Invalid provider entry %q", entry)
+		}
+		u, err := url.Parse(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		p := OpenIDProvider{ConfigurationURL: u, RefreshInterval: defaultInterval}
+		if len(fields) == 2 {
+			d, err := parseDuration(fields[1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("Invalid refresh interval %q for provider %q", fields[1], fields[0])
+			}
+			p.RefreshInterval = d
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// parseClientCredentials parses a comma separated list of client_id:client_secret pairs
+func parseClientCredentials(s string) (map[string]string, error) {
+	clients := make(map[string]string)
+	for _, e := range getList(s) {
+		i := strings.Index(e, ":")
+		if i < 1 || i == len(e)-1 {
+			return nil, fmt.Errorf("Invalid client credentials for entry %d", len(clients)+1)
+		}
+		clients[e[:i]] = e[i+1:]
+	}
+	return clients, nil
+}
+
 func getString(v string, def string) string {
 	s, ok := os.LookupEnv(v)
 	if !ok {
@@ -160,6 +455,17 @@ func getString(v string, def string) string {
 	return s
 }
 
+// getList splits a comma separated list, ignoring blanks around and between the elements
+func getList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
 func getURL(v string) (*url.URL, error) {
 	u, ok := os.LookupEnv(v)
 	if !ok || u == "" {
@@ -180,19 +486,53 @@ func getInt(v string, def int) int {
 	return i
 }
 
+func getBool(v string, def bool) bool {
+	s, ok := os.LookupEnv(v)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return def
+	}
+	return b
+}
+
 func getDuration(v string, def time.Duration) time.Duration {
 	s, ok := os.LookupEnv(v)
 	if !ok || s == "" {
 		return def
 	}
 
-	if d, err := time.ParseDuration(s); err == nil {
+	if d, err := parseDuration(s); err == nil {
 		return d
 	}
 
-	if seconds, err := strconv.Atoi(s); err == nil {
-		return time.Duration(seconds) * time.Second
+	return def
+}
+
+// parseDuration accepts anything understood by time.ParseDuration or a plain number of seconds
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
 	}
 
-	return def
+	seconds, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid duration %q", s)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// loadCertPool reads the PEM encoded certificates from the file at path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", path)
+	}
+	return pool, nil
 }
@@ -1,8 +1,16 @@
 package options
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -85,6 +93,31 @@ func TestGetInt(t *testing.T) {
 	}
 }
 
+func TestGetBool(t *testing.T) {
+	for _, test := range []struct {
+		envSet string
+		value  string
+		envGet string
+		def    bool
+		want   bool
+	}{
+		{"T1", "", "T1", true, true},
+		{"T1", "invalid-bool", "T1", false, false},
+		{"", "", "DIFFICULT_TO_GUESS", true, true},
+		{"T1", "true", "T1", false, true},
+		{"T1", "1", "T1", false, true},
+		{"T1", "false", "T1", true, false},
+	} {
+		os.Clearenv()
+		if test.envSet != "" {
+			os.Setenv(test.envSet, test.value)
+		}
+		if b := getBool(test.envGet, test.def); b != test.want {
+			t.Errorf("Failed to retrieve the correct value from the environment. Wanted %t, got %t", test.want, b)
+		}
+	}
+}
+
 func TestGetDuration(t *testing.T) {
 	for _, test := range []struct {
 		envSet string
@@ -135,13 +168,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -158,13 +199,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -183,13 +232,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -292,13 +349,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -319,13 +384,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -347,13 +420,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     ":80",
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -375,13 +456,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              ":80",
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -403,13 +492,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     time.Minute,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -431,13 +528,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 time.Millisecond,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -462,13 +567,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              10 * time.Millisecond,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -493,13 +606,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              10 * time.Millisecond,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -521,13 +642,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                10 * time.Minute,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -549,13 +678,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: 30 * time.Second,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -577,13 +714,21 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       "TestSalt",
 				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
@@ -605,30 +750,1019 @@ func TestLoading(t *testing.T) {
 				HTTPClientTimeout:                 defaultHTTPClientTimeout,
 				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
 				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
 				ListenAddress:                     defaultListenAddress,
 				MetricsListenAddress:              defaultMetricsListenAddress,
 				RevocationCacheTTL:                defaultRevocationCacheTTL,
 				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
 				HashingSalt:                       defaultHashingSalt,
 				RevocationRefreshTolerance:        30 * time.Second,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
 				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
 			},
 			false,
 		},
-	} {
-		os.Clearenv()
-		for k, v := range test.env {
-			os.Setenv(k, v)
-		}
-		err := LoadFromEnvironment()
-		if test.wantFail {
-			if err == nil {
-				t.Errorf("TEST %s: Wanted failure to load settings but it seems that it succeeded: %+v", test.name, test)
-			}
-		} else {
-			if !reflect.DeepEqual(AppSettings, test.want) {
-				t.Errorf("TEST %s: Settings mismatch.\nWanted %+v\nGot %+v", test.name, test.want, AppSettings)
-			}
+		{
+			"16",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"ALLOWED_AUDIENCES":                 "my-service, legacy",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				AllowedAudiences:                  []string{"my-service", "legacy"},
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"17",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"JWT_LEEWAY":                        "2s",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtLeeway:                         2 * time.Second,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"18",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"ERROR_REASONS":                     "true",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				ErrorReasons:                      true,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"19",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"BATCH_MAX_SIZE":                    "10",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      10,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"20",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"JWT_EXPOSED_CLAIMS":                "https://identity.zalando.com/managed-id, groups",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				ExposedClaims:                     []string{"https://identity.zalando.com/managed-id", "groups"},
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"21",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"JWT_ALLOWED_ALGORITHMS":            "ES256,EdDSA",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				AllowedAlgorithms:                 []string{"ES256", "EdDSA"},
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"22",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"JWKS_MIN_RSA_KEY_SIZE":             "3072",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 3072,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"23",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":             "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL":  "http://example.com",
+				"REVOCATION_PROVIDER_URL":            "http://example.com",
+				"OPENID_PROVIDER_ON_DEMAND_INTERVAL": "1m",
+				"OPENID_PROVIDER_ON_DEMAND_TIMEOUT":  "0",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    time.Minute,
+				OpenIDProviderOnDemandTimeout:     0,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"24",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":               "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL":    "http://example.com",
+				"REVOCATION_PROVIDER_URL":              "http://example.com",
+				"OPENID_PROVIDER_MIN_REFRESH_INTERVAL": "1m",
+				"OPENID_PROVIDER_MAX_REFRESH_INTERVAL": "1h",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  time.Minute,
+				OpenIDProviderMaxRefreshInterval:  time.Hour,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"25",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":               "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL":    "http://example.com",
+				"REVOCATION_PROVIDER_URL":              "http://example.com",
+				"OPENID_PROVIDER_MIN_REFRESH_INTERVAL": "1h",
+			},
+			nil,
+			true,
+		},
+		{
+			"26",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"OPENID_PROVIDER_KEY_GRACE_PERIOD":  "8h",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				OpenIDProviderKeyGracePeriod:      8 * time.Hour,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"27",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":                 "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL":      "http://example.com",
+				"REVOCATION_PROVIDER_URL":                "http://example.com",
+				"OPENID_PROVIDER_REFUSE_KEY_REPLACEMENT": "true",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				OpenIDRefuseKeyReplacement:        true,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"28",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"SNAPSHOT_DIR":                      os.TempDir(),
+				"SNAPSHOT_MAX_AGE":                  "1h",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotDir:                       os.TempDir(),
+				SnapshotMaxAge:                    time.Hour,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"29",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"SNAPSHOT_DIR":                      "/this/does/not/exist",
+			},
+			nil,
+			true,
+		},
+		{
+			"30",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":       "http://example.com",
+				"REVOCATION_PROVIDER_URL":      "http://example.com",
+				"KEY_SOURCES":                  "jwks_file,pem_dir",
+				"JWKS_FILE":                    "/etc/planb/jwks.json",
+				"PEM_KEYS_DIR":                 "/etc/planb/keys",
+				"STATIC_KEYS_ISSUER":           "PlanB",
+				"STATIC_KEYS_REFRESH_INTERVAL": "1m",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				KeySources:                        []string{KeySourceJWKSFile, KeySourcePEMDir},
+				JWKSFile:                          "/etc/planb/jwks.json",
+				PEMKeysDir:                        "/etc/planb/keys",
+				StaticKeysIssuer:                  "PlanB",
+				StaticKeysRefreshInterval:         time.Minute,
+			},
+			false,
+		},
+		{
+			"31",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":  "http://example.com",
+				"REVOCATION_PROVIDER_URL": "http://example.com",
+				"KEY_SOURCES":             "pem_dir,openid",
+				"PEM_KEYS_DIR":            "/etc/planb/keys",
+			},
+			nil,
+			true,
+		},
+		{
+			"32",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"KEY_SOURCES":                       "jwks_file",
+			},
+			nil,
+			true,
+		},
+		{
+			"33",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"KEY_SOURCES":                       "openid,foo",
+			},
+			nil,
+			true,
+		},
+		{
+			"34",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"REVOCATION_STREAM_URL":             "http://example.com",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				RevocationStreamURL:               exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"35",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"REVOCATION_STREAM_URL":             "://example.com",
+			},
+			nil,
+			true,
+		},
+		{
+			"36",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"ADMIN_LISTEN_ADDRESS":              ":9022",
+				"ADMIN_CREDENTIALS":                 "admin:secret",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				AdminListenAddress:                ":9022",
+				AdminCredentials:                  map[string]string{"admin": "secret"},
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"37",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"ADMIN_LISTEN_ADDRESS":              ":9022",
+			},
+			nil,
+			true,
+		},
+		{
+			"38",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"ADMIN_LISTEN_ADDRESS":              ":9020",
+				"ADMIN_CREDENTIALS":                 "admin:secret",
+			},
+			nil,
+			true,
+		},
+		{
+			"39",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":              "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL":   "http://example.com",
+				"REVOCATION_PROVIDER_URL":             "http://example.com",
+				"REVOCATION_HASHING_SALT":             "newsalt",
+				"REVOCATION_ADDITIONAL_HASHING_SALTS": "oldsalt, oldersalt",
+				"REVOCATION_REFUSE_DEFAULT_SALT":      "true",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       "newsalt",
+				AdditionalHashingSalts:            []string{"oldsalt", "oldersalt"},
+				RefuseDefaultHashingSalt:          true,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"40",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"REVOCATION_REFUSE_DEFAULT_SALT":    "true",
+			},
+			nil,
+			true,
+		},
+		{
+			"41",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"KEY_SOURCES":                       "jwks_file,openid",
+				"JWKS_FILE":                         "/etc/planb/jwks.json",
+				"STATIC_KEYS_ISSUER":                "Partner",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				KeySources:                        []string{KeySourceJWKSFile, KeySourceOpenID},
+				JWKSFile:                          "/etc/planb/jwks.json",
+				StaticKeysIssuer:                  "Partner",
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+			},
+			false,
+		},
+		{
+			"42",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"KEY_SOURCES":                       "openid,pem_dir",
+				"PEM_KEYS_DIR":                      "/etc/planb/keys",
+			},
+			nil,
+			true,
+		},
+		{
+			"43",
+			map[string]string{
+				"UPSTREAM_TOKENINFO_URL":            "http://example.com",
+				"OPENID_PROVIDER_CONFIGURATION_URL": "http://example.com",
+				"REVOCATION_PROVIDER_URL":           "http://example.com",
+				"JWT_LENIENT_KEY_BINDING":           "true",
+			},
+			&Settings{
+				UpstreamTokenInfoURL:              exampleCom,
+				OpenIDProviderConfigurationURL:    exampleCom,
+				RevocationProviderUrl:             exampleCom,
+				UpstreamCacheMaxSize:              defaultUpstreamCacheMaxSize,
+				UpstreamCacheTTL:                  defaultUpstreamCacheTTL,
+				UpstreamTimeout:                   defaultUpstreamTimeout,
+				HTTPClientTimeout:                 defaultHTTPClientTimeout,
+				HTTPClientTLSTimeout:              defaultHTTPClientTLSTimeout,
+				OpenIDProviderRefreshInterval:     defaultOpenIDRefreshInterval,
+				OpenIDProviderOnDemandInterval:    defaultOpenIDOnDemandInterval,
+				OpenIDProviderOnDemandTimeout:     defaultOpenIDOnDemandTimeout,
+				OpenIDProviderMinRefreshInterval:  defaultOpenIDMinRefreshInterval,
+				OpenIDProviderMaxRefreshInterval:  defaultOpenIDMaxRefreshInterval,
+				ListenAddress:                     defaultListenAddress,
+				MetricsListenAddress:              defaultMetricsListenAddress,
+				RevocationCacheTTL:                defaultRevocationCacheTTL,
+				RevocationProviderRefreshInterval: defaultRevokeProviderRefreshInterval,
+				HashingSalt:                       defaultHashingSalt,
+				RevocationRefreshTolerance:        defaultRevocationRereshTolerance,
+				BatchMaxSize:                      defaultBatchMaxSize,
+				JWKSMinRSAKeySize:                 defaultJWKSMinRSAKeySize,
+				JwtProcessors:                     make(map[string]processor.JwtProcessor),
+				SnapshotMaxAge:                    defaultSnapshotMaxAge,
+				StaticKeysRefreshInterval:         defaultStaticKeysRefreshInterval,
+				LenientKeyBinding:                 true,
+			},
+			false,
+		},
+	} {
+		os.Clearenv()
+		for k, v := range test.env {
+			os.Setenv(k, v)
+		}
+		err := LoadFromEnvironment()
+		if test.wantFail {
+			if err == nil {
+				t.Errorf("TEST %s: Wanted failure to load settings but it seems that it succeeded: %+v", test.name, test)
+			}
+		} else {
+			if !reflect.DeepEqual(AppSettings, test.want) {
+				t.Errorf("TEST %s: Settings mismatch.\nWanted %+v\nGot %+v", test.name, test.want, AppSettings)
+			}
+		}
+	}
+}
+
+func TestParseOpenIDProviders(t *testing.T) {
+	idp1, _ := url.Parse("https://idp1.example.org/.well-known/openid-configuration")
+	idp2, _ := url.Parse("https://idp2.example.org/.well-known/openid-configuration")
+	for _, test := range []struct {
+		value     string
+		want      []OpenIDProvider
+		wantError bool
+	}{
+		{"", nil, false},
+		{
+			"https://idp1.example.org/.well-known/openid-configuration",
+			[]OpenIDProvider{{idp1, time.Minute}},
+			false,
+		},
+		{
+			"https://idp1.example.org/.well-known/openid-configuration 10s, https://idp2.example.org/.well-known/openid-configuration",
+			[]OpenIDProvider{{idp1, 10 * time.Second}, {idp2, time.Minute}},
+			false,
+		},
+		{"https://idp1.example.org/.well-known/openid-configuration 30", []OpenIDProvider{{idp1, 30 * time.Second}}, false},
+		{"https://idp1.example.org/.well-known/openid-configuration never", nil, true},
+		{"https://idp1.example.org/.well-known/openid-configuration 0", nil, true},
+		{"https://idp1.example.org/.well-known/openid-configuration 1m 2m", nil, true},
+		{"http://192.168.0.%31/", nil, true},
+	} {
+		p, err := parseOpenIDProviders(test.value, time.Minute)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("Expected an error but call succeeded: %q", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.value, err)
+		}
+		if !reflect.DeepEqual(p, test.want) {
+			t.Errorf("Unexpected providers for %q. Wanted %+v, got %+v", test.value, test.want, p)
+		}
+	}
+}
+
+func TestOpenIDProviders(t *testing.T) {
+	os.Clearenv()
+	os.Setenv("OPENID_PROVIDER_CONFIGURATION_URL", "http://example.com")
+	os.Setenv("REVOCATION_PROVIDER_URL", "http://example.com")
+	os.Setenv("OPENID_PROVIDER_REFRESH_INTERVAL", "1m")
+	os.Setenv("OPENID_ADDITIONAL_PROVIDERS", "http://partner.example.com, http://other.example.com 5m")
+	if err := LoadFromEnvironment(); err != nil {
+		t.Fatal("Failed to load settings: ", err)
+	}
+
+	p := AppSettings.OpenIDProviders()
+	if len(p) != 3 {
+		t.Fatalf("Wrong amount of providers. Wanted 3, got %d", len(p))
+	}
+	for i, want := range []struct {
+		url      string
+		interval time.Duration
+	}{
+		{"http://example.com", time.Minute},
+		{"http://partner.example.com", time.Minute},
+		{"http://other.example.com", 5 * time.Minute},
+	} {
+		if p[i].ConfigurationURL.String() != want.url || p[i].RefreshInterval != want.interval {
+			t.Errorf("Unexpected provider %d. Wanted %s (%v), got %s (%v)", i, want.url, want.interval, p[i].ConfigurationURL, p[i].RefreshInterval)
+		}
+	}
+
+	os.Setenv("OPENID_ADDITIONAL_PROVIDERS", "http://partner.example.com never")
+	if err := LoadFromEnvironment(); err == nil {
+		t.Error("Expected failure with an invalid refresh interval")
+	}
+}
+
+func TestJwtProcessorsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "processors.json")
+	config := `{"https://partner.example.com": {"uid": "preferred_username", "realm": ""}}`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Clearenv()
+	os.Setenv("OPENID_PROVIDER_CONFIGURATION_URL", "http://example.com")
+	os.Setenv("REVOCATION_PROVIDER_URL", "http://example.com")
+	os.Setenv("JWT_PROCESSORS_CONFIG", path)
+	if err := LoadFromEnvironment(); err != nil {
+		t.Fatal("Failed to load settings: ", err)
+	}
+
+	if _, ok := AppSettings.JwtProcessors["https://partner.example.com"]; !ok || len(AppSettings.JwtProcessors) != 1 {
+		t.Errorf("Unexpected JWT processors: %+v", AppSettings.JwtProcessors)
+	}
+
+	os.Setenv("JWT_PROCESSORS_CONFIG", filepath.Join(dir, "missing.json"))
+	if err := LoadFromEnvironment(); err == nil {
+		t.Error("Expected failure with a missing config file")
+	}
+}
+
+func TestJWKSCABundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true}
+	der, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	bundle := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	empty := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(empty, []byte("no certificates"), 0600)
+
+	for _, test := range []struct {
+		path     string
+		wantFail bool
+	}{
+		{bundle, false},
+		{empty, true},
+		{filepath.Join(dir, "missing.pem"), true},
+	} {
+		os.Clearenv()
+		os.Setenv("OPENID_PROVIDER_CONFIGURATION_URL", "http://example.com")
+		os.Setenv("REVOCATION_PROVIDER_URL", "http://example.com")
+		os.Setenv("JWKS_CA_BUNDLE", test.path)
+		err := LoadFromEnvironment()
+		if test.wantFail {
+			if err == nil {
+				t.Errorf("Expected failure with the CA bundle %q", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to load the CA bundle %q: %v", test.path, err)
+		}
+		if AppSettings.JWKSRootCAs == nil {
+			t.Errorf("Missing root CAs from %q", test.path)
+		}
+	}
+}
+
+func TestGetList(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"a", []string{"a"}},
+		{"a,b", []string{"a", "b"}},
+		{" a , b ,, c ", []string{"a", "b", "c"}},
+	} {
+		if l := getList(test.value); !reflect.DeepEqual(l, test.want) {
+			t.Errorf("Unexpected list for %q. Wanted %v, got %v", test.value, test.want, l)
+		}
+	}
+}
+
+func TestParseClientCredentials(t *testing.T) {
+	for _, test := range []struct {
+		value     string
+		want      map[string]string
+		wantError bool
+	}{
+		{"client:secret", map[string]string{"client": "secret"}, false},
+		{"a:s1, b:s:2", map[string]string{"a": "s1", "b": "s:2"}, false},
+		{"client", nil, true},
+		{":secret", nil, true},
+		{"client:", nil, true},
+	} {
+		c, err := parseClientCredentials(test.value)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("Expected an error but call succeeded: %q", test.value)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(c, test.want) {
+			t.Errorf("Unexpected credentials for %q. Wanted %v, got %v", test.value, test.want, c)
 		}
 	}
 }
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const defaultGrantType = "password"
+
+// A ClaimError is returned by the ClaimMapping when a mapped claim is missing or has an invalid value
+type ClaimError struct {
+	Claim string
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("Invalid claim: %s", e.Claim)
+}
+
+// ClaimMapping is a JwtProcessor that maps the claims named in its fields to the TokenInfo. The uid, scope
+// and exp claims are required, as well as the realm claim if it's named. The client_id and grant_type
+// claims are optional, and the grant type defaults to "password". The scope claim can be either an array
+// of strings or a space separated string. The PrivateClaims are copied to the TokenInfo when present
+type ClaimMapping struct {
+	UID           string   `json:"uid"`
+	Realm         string   `json:"realm"`
+	Scope         string   `json:"scope"`
+	ClientId      string   `json:"client_id"`
+	GrantType     string   `json:"grant_type"`
+	PrivateClaims []string `json:"private_claims"`
+}
+
+// PlanBClaimMapping is the standard mapping of the Plan B OpenID Connect Provider tokens
+var PlanBClaimMapping = ClaimMapping{UID: "sub", Realm: "realm", Scope: "scope", ClientId: "azp"}
+
+// Process maps the claims of the token t to a TokenInfo
+func (m *ClaimMapping) Process(t *jwt.Token, timeBase time.Time) (*TokenInfo, error) {
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported claims type %T", t.Claims)
+	}
+
+	uid, ok := stringClaim(claims, m.UID)
+	if !ok {
+		return nil, &ClaimError{m.UID}
+	}
+
+	scope, ok := scopeClaim(claims, m.Scope)
+	if !ok {
+		return nil, &ClaimError{m.Scope}
+	}
+
+	realm := ""
+	if m.Realm != "" {
+		if realm, ok = stringClaim(claims, m.Realm); !ok {
+			return nil, &ClaimError{m.Realm}
+		}
+	}
+
+	clientId, err := optionalStringClaim(claims, m.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	grantType, err := optionalStringClaim(claims, m.GrantType)
+	if err != nil {
+		return nil, err
+	}
+	if grantType == "" {
+		grantType = defaultGrantType
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, &ClaimError{"exp"}
+	}
+
+	ti := &TokenInfo{
+		AccessToken: t.Raw,
+		UID:         uid,
+		GrantType:   grantType,
+		Scope:       scope,
+		Realm:       realm,
+		ClientId:    clientId,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Unix(int64(exp), 0).Sub(timeBase).Seconds()),
+	}
+
+	for _, name := range m.PrivateClaims {
+		c, has := claims[name]
+		if !has {
+			continue
+		}
+		if ti.PrivateClaims == nil {
+			ti.PrivateClaims = make(map[string]interface{})
+		}
+		ti.PrivateClaims[name] = c
+	}
+	return ti, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) (string, bool) {
+	c, has := claims[name]
+	if !has {
+		return "", false
+	}
+	s, ok := c.(string)
+	if !ok {
+		log.Printf("Invalid string value for claim %q = %v", name, c)
+	}
+	return s, ok
+}
+
+// optionalStringClaim returns an empty string when the claim is not named or not present
+func optionalStringClaim(claims jwt.MapClaims, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if _, has := claims[name]; !has {
+		return "", nil
+	}
+	s, ok := stringClaim(claims, name)
+	if !ok {
+		return "", &ClaimError{name}
+	}
+	return s, nil
+}
+
+func scopeClaim(claims jwt.MapClaims, name string) ([]string, bool) {
+	switch c := claims[name].(type) {
+	case string:
+		return strings.Fields(c), true
+	case nil:
+		return nil, false
+	case []interface{}:
+		result := make([]string, len(c))
+		for i, v := range c {
+			s, ok := v.(string)
+			if !ok {
+				log.Printf("Invalid string array value for claim %q = %v", name, c)
+				return nil, false
+			}
+			result[i] = s
+		}
+		return result, true
+	default:
+		log.Printf("Invalid scope value for claim %q = %v", name, c)
+		return nil, false
+	}
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestClaimMapping(t *testing.T) {
+	now := time.Unix(time.Now().Unix(), 0)
+	exp := float64(now.Add(time.Hour).Unix())
+	for _, test := range []struct {
+		mapping ClaimMapping
+		claims  jwt.MapClaims
+		want    *TokenInfo
+		wantErr string
+	}{
+		{
+			PlanBClaimMapping,
+			jwt.MapClaims{"sub": "foo", "realm": "/services", "scope": []interface{}{"uid"}, "azp": "bar", "exp": exp},
+			&TokenInfo{UID: "foo", Realm: "/services", Scope: []string{"uid"}, ClientId: "bar", GrantType: "password"},
+			"",
+		},
+		{
+			PlanBClaimMapping,
+			jwt.MapClaims{"sub": "foo", "scope": []interface{}{"uid"}, "exp": exp},
+			nil,
+			"Invalid claim: realm",
+		},
+		{
+			PlanBClaimMapping,
+			jwt.MapClaims{"sub": "foo", "realm": "/services", "scope": []interface{}{"uid"}, "azp": 42, "exp": exp},
+			nil,
+			"Invalid claim: azp",
+		},
+		{
+			PlanBClaimMapping,
+			jwt.MapClaims{"sub": "foo", "realm": "/services", "scope": []interface{}{"uid"}},
+			nil,
+			"Invalid claim: exp",
+		},
+		{
+			ClaimMapping{UID: "preferred_username", Scope: "scp", ClientId: "client_id", GrantType: "gty", PrivateClaims: []string{"email", "groups", "missing"}},
+			jwt.MapClaims{"preferred_username": "jdoe", "scp": "read write", "client_id": "app", "gty": "client_credentials",
+				"email": "jdoe@example.org", "groups": []interface{}{"a", "b"}, "exp": exp},
+			&TokenInfo{UID: "jdoe", Scope: []string{"read", "write"}, ClientId: "app", GrantType: "client_credentials",
+				PrivateClaims: map[string]interface{}{"email": "jdoe@example.org", "groups": []interface{}{"a", "b"}}},
+			"",
+		},
+		{
+			ClaimMapping{UID: "sub", Scope: "scp"},
+			jwt.MapClaims{"sub": "foo", "scope": []interface{}{"uid"}, "exp": exp},
+			nil,
+			"Invalid claim: scp",
+		},
+	} {
+		ti, err := test.mapping.Process(&jwt.Token{Raw: "raw", Claims: test.claims}, now)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("Wrong error for %v. Wanted %q, got %v", test.claims, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", test.claims, err)
+			continue
+		}
+
+		test.want.AccessToken = "raw"
+		test.want.TokenType = "Bearer"
+		test.want.ExpiresIn = 3600
+		if !reflect.DeepEqual(ti, test.want) {
+			t.Errorf("Wrong token info for %v.\nWanted %+v\nGot %+v", test.claims, test.want, ti)
+		}
+	}
+}
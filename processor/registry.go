@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+var registry = map[string]JwtProcessor{
+	"planb":   &PlanBClaimMapping,
+	"rfc9068": &ClaimMapping{UID: "sub", Scope: "scope", ClientId: "client_id"},
+}
+
+// Register makes the JwtProcessor p available by name in the configuration. It's meant to be called
+// from the init function of the package that implements p, and it replaces any processor with the same name
+func Register(name string, p JwtProcessor) {
+	registry[name] = p
+}
+
+// Lookup returns the JwtProcessor registered with the name
+func Lookup(name string) (JwtProcessor, bool) {
+	p, ok := registry[name]
+	return p, ok
+}
+
+// processorConfig is either the name of a registered JwtProcessor or a ClaimMapping. The claims that
+// are not set in the ClaimMapping default to the ones of the PlanBClaimMapping
+type processorConfig struct {
+	Processor string `json:"processor"`
+	ClaimMapping
+}
+
+// ParseConfig reads the JwtProcessor for each issuer from a JSON object like:
+//
+//	{
+//	    "https://identity.example.org": {"processor": "planb"},
+//	    "https://partner.example.org": {"uid": "preferred_username", "realm": "", "private_claims": ["email"]}
+//	}
+func ParseConfig(r io.Reader) (map[string]JwtProcessor, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	processors := make(map[string]JwtProcessor, len(raw))
+	for issuer, v := range raw {
+		c := processorConfig{ClaimMapping: PlanBClaimMapping}
+		d := json.NewDecoder(bytes.NewReader(v))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&c); err != nil {
+			return nil, fmt.Errorf("Invalid processor for issuer %q: %v.", issuer, err)
+		}
+
+		if c.Processor != "" {
+			if !reflect.DeepEqual(c.ClaimMapping, PlanBClaimMapping) {
+				return nil, fmt.Errorf("Either a processor or a claim mapping can be set for issuer %q.", issuer)
+			}
+			p, ok := Lookup(c.Processor)
+			if !ok {
+				return nil, fmt.Errorf("Unknown processor %q for issuer %q.", c.Processor, issuer)
+			}
+			processors[issuer] = p
+			continue
+		}
+
+		if c.UID == "" || c.Scope == "" {
+			return nil, fmt.Errorf("The uid and scope claims are required for issuer %q.", issuer)
+		}
+		m := c.ClaimMapping
+		processors[issuer] = &m
+	}
+	return processors, nil
+}
+
+// LoadConfigFile reads the JwtProcessor for each issuer from the JSON file at path. See ParseConfig
+func LoadConfigFile(path string) (map[string]JwtProcessor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConfig(f)
+}
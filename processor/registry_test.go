@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type testProcessor struct{}
+
+func (p *testProcessor) Process(t *jwt.Token, timeBase time.Time) (*TokenInfo, error) {
+	return &TokenInfo{UID: "test"}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	if p, ok := Lookup("planb"); !ok || p != &PlanBClaimMapping {
+		t.Error("The planb processor should be registered")
+	}
+
+	if _, ok := Lookup("test"); ok {
+		t.Error("The test processor should not be registered yet")
+	}
+
+	p := new(testProcessor)
+	Register("test", p)
+	defer delete(registry, "test")
+	if found, ok := Lookup("test"); !ok || found != p {
+		t.Error("The test processor should be registered")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	for _, test := range []struct {
+		config  string
+		want    map[string]JwtProcessor
+		wantErr bool
+	}{
+		{`{}`, map[string]JwtProcessor{}, false},
+		{`{"https://idp.example.org": {"processor": "planb"}}`, map[string]JwtProcessor{"https://idp.example.org": &PlanBClaimMapping}, false},
+		{
+			`{"https://idp.example.org": {"uid": "preferred_username", "realm": "", "private_claims": ["email"]}}`,
+			map[string]JwtProcessor{"https://idp.example.org": &ClaimMapping{UID: "preferred_username", Scope: "scope", ClientId: "azp", PrivateClaims: []string{"email"}}},
+			false,
+		},
+		{`{"https://idp.example.org": {"processor": "unknown"}}`, nil, true},
+		{`{"https://idp.example.org": {"processor": "planb", "uid": "email"}}`, nil, true},
+		{`{"https://idp.example.org": {"uid": ""}}`, nil, true},
+		{`{"https://idp.example.org": {"username": "email"}}`, nil, true},
+		{`{"https://idp.example.org": "planb"}`, nil, true},
+		{`[]`, nil, true},
+	} {
+		p, err := ParseConfig(strings.NewReader(test.config))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.config, err)
+		}
+		if !reflect.DeepEqual(p, test.want) {
+			t.Errorf("Wrong processors for %s. Wanted %+v, got %+v", test.config, test.want, p)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "processors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "processors.json")
+	if err := ioutil.WriteFile(path, []byte(`{"https://idp.example.org": {"processor": "rfc9068"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatal("Failed to load the config file: ", err)
+	}
+	if _, ok := p["https://idp.example.org"]; !ok {
+		t.Errorf("Missing processor for the issuer: %+v", p)
+	}
+
+	if _, err := LoadConfigFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -16,6 +16,8 @@ type Cache struct {
 	ts           chan *request // timestamp
 	cName        chan *request // claim names
 	forceRefresh chan int      // expire from timestamp
+	snapshot     chan *request
+	hashAlgs     chan *request // hash algorithms
 }
 
 // request structure holds key-value/result pairs that are transferred through the cache channels.
@@ -31,6 +33,16 @@ func incrementClaimCount(r *request, n map[string]int) {
 	}
 }
 
+// Adds delta to the number of revocations with the hash algorithm of rev, if it's hashed.
+func countHashAlgorithm(rev interface{}, a map[string]int, delta int) {
+	if r := rev.(*Revocation); isHashedRevocation(r.Type) {
+		alg := hashAlgorithm(r)
+		if a[alg] += delta; a[alg] <= 0 {
+			delete(a, alg)
+		}
+	}
+}
+
 // Return a new revocation Cache instance.
 func NewCache() *Cache {
 
@@ -41,10 +53,13 @@ func NewCache() *Cache {
 	ts := make(chan *request)
 	cName := make(chan *request)
 	forceRefresh := make(chan int)
+	snapshot := make(chan *request)
+	hashAlgs := make(chan *request)
 
 	go func() {
 		c := make(map[string]interface{}) // store revocations
 		n := make(map[string]int)         // store all claim names
+		a := make(map[string]int)         // store all hash algorithms
 		t := 0                            // store last pull timestamp
 
 		for {
@@ -58,10 +73,13 @@ func NewCache() *Cache {
 					if value.(*Revocation).Data["issued_before"].(int) < r.val.(*Revocation).Data["issued_before"].(int) {
 						c[r.key] = r.val
 						incrementClaimCount(r, n)
+						countHashAlgorithm(value, a, -1)
+						countHashAlgorithm(r.val, a, 1)
 					}
 				} else {
 					c[r.key] = r.val
 					incrementClaimCount(r, n)
+					countHashAlgorithm(r.val, a, 1)
 				}
 			case r := <-del:
 				rev := c[r.key]
@@ -69,6 +87,9 @@ func NewCache() *Cache {
 					n[rev.(*Revocation).Data["names"].(string)] -= 1
 					updateClaimNames(n)
 				}
+				if rev != nil {
+					countHashAlgorithm(rev, a, -1)
+				}
 				delete(c, r.key)
 			case r := <-forceRefresh:
 				for key, rev := range c {
@@ -76,6 +97,7 @@ func NewCache() *Cache {
 						if rev.(*Revocation).Type == REVOCATION_TYPE_CLAIM {
 							n[rev.(*Revocation).Data["names"].(string)] -= 1
 						}
+						countHashAlgorithm(rev, a, -1)
 						delete(c, key)
 					}
 				}
@@ -94,17 +116,32 @@ func NewCache() *Cache {
 						if rev.(*Revocation).Type == REVOCATION_TYPE_CLAIM {
 							n[rev.(*Revocation).Data["names"].(string)] -= 1
 						}
+						countHashAlgorithm(rev, a, -1)
 						delete(c, key)
 					}
 				}
 				updateClaimNames(n)
 			case r := <-get:
 				r.res <- c[r.key]
+			case r := <-snapshot:
+				revs := make([]*Revocation, 0, len(c))
+				for _, rev := range c {
+					revs = append(revs, rev.(*Revocation))
+				}
+				r.res <- revs
+			case r := <-hashAlgs:
+				var algs []string
+				for _, alg := range hashAlgorithms {
+					if a[alg] > 0 {
+						algs = append(algs, alg)
+					}
+				}
+				r.res <- algs
 			}
 		}
 	}()
 
-	return &Cache{get: get, set: set, del: del, expire: expire, ts: ts, cName: cName, forceRefresh: forceRefresh}
+	return &Cache{get: get, set: set, del: del, expire: expire, ts: ts, cName: cName, forceRefresh: forceRefresh, snapshot: snapshot, hashAlgs: hashAlgs}
 }
 
 // Returns the value of a key in the revocation cache. nil if the key does not exist.
@@ -141,6 +178,22 @@ func (c *Cache) GetClaimNames() []string {
 	return names
 }
 
+// Returns all the revocations stored in the cache.
+// Used to persist the cache.
+func (c *Cache) Snapshot() []*Revocation {
+	res := make(chan interface{})
+	c.snapshot <- &request{res: res}
+	return (<-res).([]*Revocation)
+}
+
+// Returns the hash algorithms of the revocations stored in the cache, in the order they should be tried.
+// Used to only hash tokens and claim values with the algorithms in use.
+func (c *Cache) GetHashAlgorithms() []string {
+	res := make(chan interface{})
+	c.hashAlgs <- &request{res: res}
+	return (<-res).([]string)
+}
+
 // Expire (delete) elements stored in the cache based on the REVOCATION_CACHE_TTL environment variable.
 func (c *Cache) Expire() {
 	c.expire <- true
@@ -155,10 +208,13 @@ func (c *Cache) ForceRefresh(ts int) {
 	c.forceRefresh <- ts
 }
 
-// Insert a revocation into the cache. Only allows specific revocation types (i.e. TOKEN, CLAIM, GLOBAL, FORCEREFRESH).
+// Insert a revocation into the cache. Only allows specific revocation types (i.e. TOKEN, CLAIM, GLOBAL, SUBJECT, CLIENT,
+// REALM, FORCEREFRESH).
 // REVOCATION_TYPE_TOKEN stores the key as a hash of the JWT.
 // REVOCATION_TYPE_CLAIM stores the key as a hash of the name values (each value separated by a '|')
 // REVOCATION_TYPE_GLOBAL stores the key as 'GLOBAL' as there can only be one golbal revocation.
+// REVOCATION_TYPE_SUBJECT, REVOCATION_TYPE_CLIENT and REVOCATION_TYPE_REALM store the key as the type followed by
+// the hash of the value (e.g. 'SUBJECT:<hash>').
 // REVOCATION_TYPE_FORCEREFRESH stores the key as 'FORCEREFRESH as there can only be one force refresh.
 func (c *Cache) Add(rev *Revocation) {
 	var hash string
@@ -181,6 +237,12 @@ func (c *Cache) Add(rev *Revocation) {
 		hash = rev.Data["value_hash"].(string)
 	case REVOCATION_TYPE_GLOBAL:
 		hash = REVOCATION_TYPE_GLOBAL
+	case REVOCATION_TYPE_SUBJECT, REVOCATION_TYPE_CLIENT, REVOCATION_TYPE_REALM:
+		if _, ok := rev.Data["value_hash"]; !ok {
+			log.Printf("Error adding revocation to cache: missing %s value hash.", rev.Type)
+			return
+		}
+		hash = valueRevocationKey(rev.Type, rev.Data["value_hash"].(string))
 	case REVOCATION_TYPE_FORCEREFRESH:
 		hash = REVOCATION_TYPE_FORCEREFRESH
 	default:
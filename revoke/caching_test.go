@@ -356,4 +356,24 @@ func TestCacheUpdatesExistingRevocationWithMostRecent(t *testing.T) {
 	}
 }
 
+func TestCacheValueRevocationKeys(t *testing.T) {
+	cache := NewCache()
+
+	claim := &Revocation{Type: REVOCATION_TYPE_CLAIM, Data: map[string]interface{}{"value_hash": "hash", "names": "sub", "revoked_at": 123, "issued_before": 123}}
+	cache.Add(claim)
+	subject := &Revocation{Type: REVOCATION_TYPE_SUBJECT, Data: map[string]interface{}{"value_hash": "hash", "revoked_at": 124, "issued_before": 124}}
+	cache.Add(subject)
+	cache.Add(&Revocation{Type: REVOCATION_TYPE_REALM, Data: map[string]interface{}{"revoked_at": 125, "issued_before": 125}})
+
+	if r := cache.Get("hash"); r != claim {
+		t.Errorf("Subject revocations should not replace claim revocations with the same hash. Got %#v", r)
+	}
+	if r := cache.Get("SUBJECT:hash"); r != subject {
+		t.Errorf("Subject revocation should be stored with the type in the key. Got %#v", r)
+	}
+	if ts := cache.GetLastTS(); ts != 124 {
+		t.Errorf("Realm revocation without value hash should not be added. Last timestamp: %d", ts)
+	}
+}
+
 // vim: ts=4 sw=4 noexpandtab nolist syn=go
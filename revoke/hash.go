@@ -0,0 +1,80 @@
+package revoke
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"log"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+const metricsDefaultSalt = "planb.tokeninfo.revocation.default_salt"
+
+// The cache key of TOKEN and CLAIM revocations is the hash itself.
+func hashKey(hash string) string {
+	return hash
+}
+
+// Hashes a token or claim value(s) with the hash algorithm and the salt, and base64 URL encodes it. The salt is
+// prepended to the value, except for HMAC-SHA256, which uses the salt as the key.
+func hashValue(alg string, salt string, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	var h hash.Hash
+	data := salt + value
+	switch alg {
+	case HASH_ALGORITHM_SHA384:
+		h = sha512.New384()
+	case HASH_ALGORITHM_SHA512:
+		h = sha512.New()
+	case HASH_ALGORITHM_HMAC_SHA256:
+		h = hmac.New(sha256.New, []byte(salt))
+		data = value
+	default:
+		h = sha256.New()
+	}
+	h.Write([]byte(data))
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Returns the active salts: REVOCATION_HASHING_SALT followed by REVOCATION_ADDITIONAL_HASHING_SALTS, which are
+// accepted while the salt of the Revocation Provider is rotated.
+func salts() []string {
+	return append([]string{options.AppSettings.HashingSalt}, options.AppSettings.AdditionalHashingSalts...)
+}
+
+// Returns the revocation stored under the hash of the value with any of the hash algorithms and active salts, where
+// key returns the cache key of a hash. Revocations only match the hashes of their own hash algorithm.
+func (crp *CachingRevokeProvider) lookupHash(value string, algs []string, key func(string) string) *Revocation {
+	if value == "" {
+		return nil
+	}
+	active := salts()
+	for _, alg := range algs {
+		for _, salt := range active {
+			if r := crp.cache.Get(key(hashValue(alg, salt, value))); r != nil && hashAlgorithm(r.(*Revocation)) == alg {
+				return r.(*Revocation)
+			}
+		}
+	}
+	return nil
+}
+
+// Warns loudly when the revocations are hashed with the built-in default salt. Startup is refused instead with
+// REVOCATION_REFUSE_DEFAULT_SALT.
+func checkDefaultSalt() {
+	var inUse int64
+	if options.AppSettings.UsesDefaultHashingSalt() {
+		log.Println("WARNING: revocations are hashed with the built-in default salt. Set REVOCATION_HASHING_SALT to the salt of the Revocation Provider.")
+		inUse = 1
+	}
+	if g, ok := metrics.DefaultRegistry.GetOrRegister(metricsDefaultSalt, metrics.NewGauge).(metrics.Gauge); ok {
+		g.Update(inUse)
+	}
+}
@@ -0,0 +1,96 @@
+package revoke
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestHashValue(t *testing.T) {
+	for _, test := range []struct {
+		alg  string
+		want string
+	}{
+		{HASH_ALGORITHM_SHA256, "1DCh2jCv4anQezs2BCFR669TxIgq8WCXM8BJMN4xjjM="},
+		{HASH_ALGORITHM_SHA384, "gTkh9aqrx68XRa8bquoAzB6h8SVouFTw_Jrgx6xRiyot3tJhucdlvFK-OT5pdWUX"},
+		{HASH_ALGORITHM_SHA512, "P48oQp7RPtPEFk9mSTRmETD3qe2ruzj4ovcyCfsFVOy8bzdBA7WZ02AmdUr9ALyrp_ZvKkqFD_QHbStLhAIt4A=="},
+		{HASH_ALGORITHM_HMAC_SHA256, "qvFdZPKeegb2o-VYH6IW3xZDPdCJ9D-ef7X6gkceJzs="},
+	} {
+		if got := hashValue(test.alg, "salt", "value"); got != test.want {
+			t.Errorf("Wrong %s hash. Wanted %s, got %s", test.alg, test.want, got)
+		}
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for name, want := range map[string]string{"": HASH_ALGORITHM_SHA256, "sha-512": HASH_ALGORITHM_SHA512, "HMAC-SHA256": HASH_ALGORITHM_HMAC_SHA256} {
+		if alg, err := parseHashAlgorithm(name); err != nil || alg != want {
+			t.Errorf("Wrong hash algorithm for %q. Wanted %s, got %s (%v)", name, want, alg, err)
+		}
+	}
+
+	j := &jsonRevocation{Type: REVOCATION_TYPE_TOKEN, RevokedAt: 123456}
+	j.Data.TokenHash = "hash"
+	j.Data.IssuedBefore = 123456
+	j.Data.HashAlgorithm = "MD5"
+	if _, err := j.toRevocation(); err != ErrUnsupportedHashAlgorithm {
+		t.Errorf("Revocations with unsupported hash algorithms should be rejected. Got %v", err)
+	}
+}
+
+func TestHashAlgorithmsAndSalts(t *testing.T) {
+	defer func(salt string, additional []string) {
+		options.AppSettings.HashingSalt = salt
+		options.AppSettings.AdditionalHashingSalts = additional
+	}(options.AppSettings.HashingSalt, options.AppSettings.AdditionalHashingSalts)
+	options.AppSettings.HashingSalt = "new"
+	options.AppSettings.AdditionalHashingSalts = []string{"old"}
+
+	crp := &CachingRevokeProvider{url: "localhost", cache: NewCache()}
+	if algs := crp.cache.GetHashAlgorithms(); len(algs) != 0 {
+		t.Errorf("Empty cache should have no hash algorithms. Got %v", algs)
+	}
+
+	add := func(typ string, alg string, salt string, value string) {
+		data := map[string]interface{}{"issued_before": 200000, "revoked_at": 200000, "hash_algorithm": alg}
+		if typ == REVOCATION_TYPE_TOKEN {
+			data["token_hash"] = hashValue(alg, salt, value)
+		} else {
+			data["value_hash"] = hashValue(alg, salt, value)
+		}
+		crp.cache.Add(&Revocation{Type: typ, Data: data})
+	}
+	add(REVOCATION_TYPE_TOKEN, HASH_ALGORITHM_SHA512, "old", "token1")
+	add(REVOCATION_TYPE_SUBJECT, HASH_ALGORITHM_HMAC_SHA256, "new", "jdoe")
+	add(REVOCATION_TYPE_CLIENT, HASH_ALGORITHM_SHA384, "other", "my-client")
+
+	want := []string{HASH_ALGORITHM_HMAC_SHA256, HASH_ALGORITHM_SHA384, HASH_ALGORITHM_SHA512}
+	if algs := crp.cache.GetHashAlgorithms(); !reflect.DeepEqual(algs, want) {
+		t.Errorf("Wrong hash algorithms. Wanted %v, got %v", want, algs)
+	}
+
+	for _, test := range []struct {
+		raw    string
+		claims jwt.MapClaims
+		want   bool
+	}{
+		{"token1", jwt.MapClaims{"iat": 100000.0}, true},
+		{"token2", jwt.MapClaims{"sub": "jdoe", "iat": 100000.0}, true},
+		{"token2", jwt.MapClaims{"azp": "my-client", "iat": 100000.0}, false},
+	} {
+		if got := crp.IsJWTRevoked(&jwt.Token{Raw: test.raw, Claims: test.claims}); got != test.want {
+			t.Errorf("Wrong revocation status for %q %v. Wanted %v, got %v", test.raw, test.claims, test.want, got)
+		}
+	}
+	if !crp.IsTokenRevoked("token1") {
+		t.Error("Token hashed with an additional salt should be revoked")
+	}
+
+	crp.cache.Delete(hashValue(HASH_ALGORITHM_SHA512, "old", "token1"))
+	want = []string{HASH_ALGORITHM_HMAC_SHA256, HASH_ALGORITHM_SHA384}
+	if algs := crp.cache.GetHashAlgorithms(); !reflect.DeepEqual(algs, want) {
+		t.Errorf("Hash algorithms of deleted revocations should be removed. Wanted %v, got %v", want, algs)
+	}
+}
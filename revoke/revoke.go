@@ -12,18 +12,48 @@ var (
 	REVOCATION_TYPE_TOKEN        = "TOKEN"
 	REVOCATION_TYPE_CLAIM        = "CLAIM"
 	REVOCATION_TYPE_GLOBAL       = "GLOBAL"
+	REVOCATION_TYPE_SUBJECT      = "SUBJECT"
+	REVOCATION_TYPE_CLIENT       = "CLIENT"
+	REVOCATION_TYPE_REALM        = "REALM"
 	REVOCATION_TYPE_FORCEREFRESH = "FORCEREFRESH"
 
+	// Hash algorithms of the token and claim values
+	HASH_ALGORITHM_SHA256      = "SHA-256"
+	HASH_ALGORITHM_SHA384      = "SHA-384"
+	HASH_ALGORITHM_SHA512      = "SHA-512"
+	HASH_ALGORITHM_HMAC_SHA256 = "HMAC-SHA256"
+
 	ErrInvalidRevocation = errors.New("Invalid Revocation data")
 	ErrIssuedInFuture    = errors.New("Issued in the future")
 	ErrUnsupportedType   = errors.New("Unsupported revocation type")
 	ErrMissingClaimName  = errors.New("Missing claim name")
+
+	ErrUnsupportedHashAlgorithm = errors.New("Unsupported hash algorithm")
 )
 
+// Supported hash algorithms, in the order they are tried when looking for a revocation.
+var hashAlgorithms = []string{
+	HASH_ALGORITHM_SHA256,
+	HASH_ALGORITHM_HMAC_SHA256,
+	HASH_ALGORITHM_SHA384,
+	HASH_ALGORITHM_SHA512,
+}
+
+// The SUBJECT, CLIENT and REALM revocations revoke all the tokens with a given value of a single claim. They are
+// checked in this order.
+var valueRevocations = []struct {
+	revocationType string
+	claim          string
+}{
+	{REVOCATION_TYPE_SUBJECT, "sub"},
+	{REVOCATION_TYPE_CLIENT, "azp"},
+	{REVOCATION_TYPE_REALM, "realm"},
+}
+
 // Revocation structure used to store a revocation.
 // Used in the cache.
 type Revocation struct {
-	Type string // token, claim, global
+	Type string // token, claim, global, subject, client, realm
 	Data map[string]interface{}
 }
 
@@ -38,14 +68,14 @@ type jsonRevoke struct {
 
 // Stores individual revocations from a call to the Revocation Provider.
 type jsonRevocation struct {
-	Type      string `json:"type"` // TOKEN, CLAIM, GLOBAL
+	Type      string `json:"type"` // TOKEN, CLAIM, GLOBAL, SUBJECT, CLIENT, REALM
 	RevokedAt int    `json:"revoked_at"`
 	Data      struct {
 		Names         []string `json:"names,omitempty"`          // CLAIM
-		ValueHash     string   `json:"value_hash,omitempty"`     // CLAIM
-		IssuedBefore  int      `json:"issued_before,omitempty"`  // CLAIM, TOKEN, GLOBAL
+		ValueHash     string   `json:"value_hash,omitempty"`     // CLAIM, SUBJECT, CLIENT, REALM
+		IssuedBefore  int      `json:"issued_before,omitempty"`  // all
 		TokenHash     string   `json:"token_hash,omitempty"`     // TOKEN
-		HashAlgorithm string   `json:"hash_algorithm,omitempty"` // CLAIM, TOKEN
+		HashAlgorithm string   `json:"hash_algorithm,omitempty"` // CLAIM, TOKEN, SUBJECT, CLIENT, REALM
 	} `json:"data"`
 }
 
@@ -81,6 +111,59 @@ func (j *jsonRevocation) validGlobal() bool {
 	return false
 }
 
+// Test whether the jsonRevocation holds a valid subject, client or realm revocation.
+func (j *jsonRevocation) validValue() bool {
+	if isValueRevocation(j.Type) &&
+		j.RevokedAt != 0 &&
+		j.Data.ValueHash != "" &&
+		j.Data.IssuedBefore != 0 {
+		return true
+	}
+	return false
+}
+
+// Test whether the revocation type is SUBJECT, CLIENT or REALM.
+func isValueRevocation(t string) bool {
+	for _, v := range valueRevocations {
+		if v.revocationType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Test whether the revocation type matches hashed values (i.e. everything but GLOBAL and FORCEREFRESH).
+func isHashedRevocation(t string) bool {
+	return t == REVOCATION_TYPE_TOKEN || t == REVOCATION_TYPE_CLAIM || isValueRevocation(t)
+}
+
+// Returns the hash algorithm of a revocation. Revocations without one use SHA-256.
+func hashAlgorithm(r *Revocation) string {
+	if alg, ok := r.Data["hash_algorithm"].(string); ok && alg != "" {
+		return alg
+	}
+	return HASH_ALGORITHM_SHA256
+}
+
+// Returns the supported hash algorithm with the name (case insensitive); SHA-256 if the name is empty.
+func parseHashAlgorithm(name string) (string, error) {
+	if name == "" {
+		return HASH_ALGORITHM_SHA256, nil
+	}
+	for _, alg := range hashAlgorithms {
+		if strings.EqualFold(alg, name) {
+			return alg, nil
+		}
+	}
+	return "", ErrUnsupportedHashAlgorithm
+}
+
+// Returns the cache key of a SUBJECT, CLIENT or REALM revocation. The type is part of the key, so that the same
+// value hash can be revoked by more than one type, or by a CLAIM revocation, without collisions.
+func valueRevocationKey(t string, valueHash string) string {
+	return t + ":" + valueHash
+}
+
 // Returns a Revocation if json data is valid; otherwise, return an error.
 func (j *jsonRevocation) toRevocation() (*Revocation, error) {
 
@@ -112,11 +195,27 @@ func (j *jsonRevocation) toRevocation() (*Revocation, error) {
 			log.Printf("Invalid revocation data (GLOBAL). IssuedBefore: %d, RevokedAt: %d", j.Data.IssuedBefore, j.RevokedAt)
 			return nil, ErrInvalidRevocation
 		}
+
+	case REVOCATION_TYPE_SUBJECT, REVOCATION_TYPE_CLIENT, REVOCATION_TYPE_REALM:
+		if !j.validValue() {
+			log.Printf("Invalid revocation data (%s). ValueHash: %s, IssuedBefore: %d, RevokedAt: %d", j.Type, j.Data.ValueHash, j.Data.IssuedBefore, j.RevokedAt)
+			return nil, ErrInvalidRevocation
+		}
+		r.Data["value_hash"] = j.Data.ValueHash
 	default:
 		log.Printf("Unsupported revocation type: %s", j.Type)
 		return nil, ErrUnsupportedType
 	}
 
+	if isHashedRevocation(j.Type) {
+		alg, err := parseHashAlgorithm(j.Data.HashAlgorithm)
+		if err != nil {
+			log.Printf("Invalid revocation data (%s). Unsupported hash algorithm: %s", j.Type, j.Data.HashAlgorithm)
+			return nil, err
+		}
+		r.Data["hash_algorithm"] = alg
+	}
+
 	if t := int(time.Now().Unix()); j.Data.IssuedBefore > t {
 		log.Printf("Invalid revocation data. IssuedBefore cannot be in the future. Now: %d, IssuedBefore: %d", t, j.Data.IssuedBefore)
 		return nil, ErrIssuedInFuture
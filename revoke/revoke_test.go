@@ -218,4 +218,24 @@ func TestGetRevocationFromJSONInvalidGlobalIssuedBefore(t *testing.T) {
 	}
 }
 
+func TestGetRevocationFromJSONValue(t *testing.T) {
+	for _, typ := range []string{REVOCATION_TYPE_SUBJECT, REVOCATION_TYPE_CLIENT, REVOCATION_TYPE_REALM} {
+		var j = &jsonRevocation{}
+		j.Type = typ
+		j.RevokedAt = 123456
+		j.Data.IssuedBefore = 123456
+		j.Data.ValueHash = "hash"
+
+		r, err := j.toRevocation()
+		if err != nil || r.Type != typ || r.Data["value_hash"] != "hash" || r.Data["issued_before"] != 123456 {
+			t.Errorf("Error getting %s revocation from jsonRevocation. Revocation: %#v, error: %v", typ, r, err)
+		}
+
+		j.Data.ValueHash = ""
+		if _, err := j.toRevocation(); err != ErrInvalidRevocation {
+			t.Errorf("%s revocation without value hash shouldn't be valid.", typ)
+		}
+	}
+}
+
 // vim: ts=4 sw=4 noexpandtab nolist syn=go
@@ -1,8 +1,6 @@
 package revoke
 
 import (
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -23,29 +21,48 @@ var scheduleFunc = Schedule
 
 // Caching provider holds the URL to the Revocation Provider and a reference to the revocation cache.
 // The URL is set with an environment variable: REVOCATION_PROVIDER_URL.
+// When the stream URL is set (REVOCATION_STREAM_URL), the revocations are pushed by the stream and polling only
+// runs while the stream is not connected.
 type CachingRevokeProvider struct {
-	url   string
-	cache *Cache
+	url       string
+	cache     *Cache
+	streamURL string
+	streaming int32
 }
 
 // Return a new CachingRevokeProvider and start polling the Revocation Provider based on a set interval.
 // Uses the environemnt variables: REVOCATION_PROVIDER_URL and REVOCATION_PROVIDER_REFRESH_INTERVAL.
+// If REVOCATION_STREAM_URL is set, it also subscribes to the revocation stream.
 func NewCachingRevokeProvider(u *url.URL) *CachingRevokeProvider {
+	checkDefaultSalt()
 	crp := &CachingRevokeProvider{url: u.String(), cache: NewCache()}
+	crp.loadSnapshot()
+	if su := options.AppSettings.RevocationStreamURL; su != nil {
+		crp.streamURL = su.String()
+		streamFunc(crp)
+	}
 	scheduleFunc(options.AppSettings.RevocationProviderRefreshInterval, crp.RefreshRevocations)
 	return crp
 }
 
-// Polls the Revocation Provider for new revocations and adds them to the revocation cache; handles the Force Refresh
-// condition (e.g. refresh cache from a specific timestamp); expires revocations older than the
-// REVOCATION_CACHE_TTL envionment variable.
-func (crp *CachingRevokeProvider) RefreshRevocations() {
+// Returns the timestamp from which new revocations are requested: the last revocation timestamp minus the
+// REVOCATION_REFRESH_TOLERANCE or, for an empty cache, the oldest timestamp kept for REVOCATION_CACHE_TTL.
+func (crp *CachingRevokeProvider) from() int {
 	ts := crp.cache.GetLastTS()
 	if ts == 0 {
 		ts = int(time.Now().Add(-1 * options.AppSettings.RevocationCacheTTL).Unix())
 	}
-	ts = ts - int(options.AppSettings.RevocationRefreshTolerance.Seconds())
+	return ts - int(options.AppSettings.RevocationRefreshTolerance.Seconds())
+}
+
+// Polls the Revocation Provider for new revocations and adds them to the revocation cache. Polling is skipped
+// while the revocation stream is connected.
+func (crp *CachingRevokeProvider) RefreshRevocations() {
+	if crp.isStreaming() {
+		return
+	}
 
+	ts := crp.from()
 	log.Printf("Checking for new revocations since %d...", ts)
 
 	resp, err := breaker.Get("refreshRevocations", crp.url+"?from="+strconv.Itoa(ts))
@@ -68,9 +85,18 @@ func (crp *CachingRevokeProvider) RefreshRevocations() {
 		return
 	}
 
+	crp.applyRevocations(jr)
+}
+
+// Adds new revocations to the revocation cache; handles the Force Refresh condition (e.g. refresh cache from a
+// specific timestamp); expires revocations older than the REVOCATION_CACHE_TTL envionment variable. Changes are
+// saved to the snapshot file, if enabled.
+func (crp *CachingRevokeProvider) applyRevocations(jr *jsonRevoke) {
+	changed := len(jr.Revs) > 0
 	if jr.Meta.RefreshTimestamp != 0 {
 		r := crp.cache.Get(REVOCATION_TYPE_FORCEREFRESH)
 		if r == nil || (r.(*Revocation).Data["revoked_at"] != jr.Meta.RefreshTimestamp) {
+			changed = true
 			log.Printf("Force refreshing cache from %d...", jr.Meta.RefreshFrom)
 			crp.cache.ForceRefresh(jr.Meta.RefreshFrom)
 			rev := &Revocation{}
@@ -97,13 +123,16 @@ func (crp *CachingRevokeProvider) RefreshRevocations() {
 
 	crp.cache.Expire()
 
+	if changed {
+		crp.saveSnapshot()
+	}
 }
 
 // Test if a JWT token is revoked by comparing the token type, the hash (cache key), and the issued at time (iat) of
 // the token.
-// Revocations are checked in the following order GLOBAL, TOKEN, CLAIM. This is to speed up processing time, as
-// GLOBAL and TOKEN revocations are much faster to test than CLAIM (CLAIM has to check each name stored in the cache
-// against the token).
+// Revocations are checked in the following order GLOBAL, TOKEN, SUBJECT, CLIENT, REALM, CLAIM. This is to speed up
+// processing time, as GLOBAL, TOKEN, SUBJECT, CLIENT and REALM revocations are a single cache lookup each, while CLAIM
+// has to check each name stored in the cache against the token.
 func (crp *CachingRevokeProvider) IsJWTRevoked(j *jwt.Token) bool {
 
 	if j.Claims == nil {
@@ -117,20 +146,82 @@ func (crp *CachingRevokeProvider) IsJWTRevoked(j *jwt.Token) bool {
 	}
 	iat := int(claims["iat"].(float64))
 
+	return crp.countRevocation(crp.findRevocation(j.Raw, claims, iat))
+}
+
+// Test if a non-JWT token, whose issued at time is not known, is revoked by a TOKEN revocation. Every token matching
+// the hash of a TOKEN revocation is revoked.
+func (crp *CachingRevokeProvider) IsTokenRevoked(raw string) bool {
+	return crp.countRevocation(crp.findTokenRevocation(raw))
+}
+
+// Test if the token info of a non-JWT token is revoked by the GLOBAL, SUBJECT, CLIENT, REALM or CLAIM revocations,
+// using the string fields of the token info as claims. The token info usually has no issued at time, in which case
+// iat should be the time it was received from the upstream, as the token was issued before.
+func (crp *CachingRevokeProvider) IsTokenInfoRevoked(fields map[string]interface{}, iat int) bool {
+	return crp.countRevocation(crp.findRevocation("", fields, iat))
+}
+
+// Returns the revocation that revokes a token, or nil if it's not revoked. Used to explain revocations, so nothing
+// is counted in the metrics. With the claims of a JWT, all the revocations are checked as in IsJWTRevoked; without
+// claims, only the TOKEN revocations are checked as in IsTokenRevoked.
+func (crp *CachingRevokeProvider) FindRevocation(raw string, claims map[string]interface{}) *Revocation {
+	if claims == nil {
+		return crp.findTokenRevocation(raw)
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil
+	}
+	return crp.findRevocation(raw, claims, int(iat))
+}
+
+// Counts the revocation, if any, and tests whether there is one.
+func (crp *CachingRevokeProvider) countRevocation(r *Revocation) bool {
+	if r == nil {
+		return false
+	}
+	countRevocations(r.Type)
+	return true
+}
+
+// Returns the TOKEN revocation matching the hash of a raw token, regardless of its issued at time.
+func (crp *CachingRevokeProvider) findTokenRevocation(raw string) *Revocation {
+	if r := crp.lookupHash(raw, crp.cache.GetHashAlgorithms(), hashKey); r != nil && r.Type == REVOCATION_TYPE_TOKEN {
+		return r
+	}
+	return nil
+}
+
+// Returns the revocation of a token, with its raw value (if known), claims and issued at time, or nil.
+func (crp *CachingRevokeProvider) findRevocation(raw string, claims map[string]interface{}, iat int) *Revocation {
+	algs := crp.cache.GetHashAlgorithms()
+
 	// check global revocation
 	if r := crp.cache.Get(REVOCATION_TYPE_GLOBAL); r != nil {
 		if val, ok := r.(*Revocation).Data["issued_before"]; ok && val.(int) > iat {
-			countRevocations(REVOCATION_TYPE_GLOBAL)
-			return true
+			return r.(*Revocation)
 		}
 	}
 
 	// check token revocation
-	th := hashTokenClaim(j.Raw)
-	if r := crp.cache.Get(th); r != nil {
-		if val, ok := r.(*Revocation).Data["issued_before"]; ok && val.(int) > iat {
-			countRevocations(REVOCATION_TYPE_TOKEN)
-			return true
+	if r := crp.lookupHash(raw, algs, hashKey); r != nil {
+		if val, ok := r.Data["issued_before"]; ok && val.(int) > iat {
+			return r
+		}
+	}
+
+	// check subject, client and realm revocations
+	for _, v := range valueRevocations {
+		val, ok := claims[v.claim].(string)
+		if !ok || val == "" {
+			continue
+		}
+		key := func(hash string) string { return valueRevocationKey(v.revocationType, hash) }
+		if r := crp.lookupHash(val, algs, key); r != nil {
+			if iss, ok := r.Data["issued_before"]; ok && iss.(int) > iat {
+				return r
+			}
 		}
 	}
 
@@ -139,45 +230,32 @@ func (crp *CachingRevokeProvider) IsJWTRevoked(j *jwt.Token) bool {
 	// if multiple claim names, the values are appended with a '|' between and then hashed
 	cNames := crp.cache.GetClaimNames()
 	for _, cName := range cNames {
-		names := strings.Split(cName, "|")
-		var vals string
-		for _, n := range names {
-			val, ok := claims[n]
-			if !ok {
-				break
-			}
-			if vals == "" {
-				vals = val.(string)
-				continue
-			}
-			vals += "|" + val.(string)
+		vals, ok := claimValues(claims, strings.Split(cName, "|"))
+		if !ok {
+			continue
 		}
-		ch := hashTokenClaim(vals)
-		if r := crp.cache.Get(ch); r != nil {
-			if v, ok := r.(*Revocation).Data["issued_before"]; ok && v.(int) > iat {
-				countRevocations(REVOCATION_TYPE_CLAIM)
-				return true
+		if r := crp.lookupHash(vals, algs, hashKey); r != nil {
+			if v, ok := r.Data["issued_before"]; ok && v.(int) > iat {
+				return r
 			}
 		}
 	}
 
-	return false
+	return nil
 }
 
-// SHA256 Hashes and base64 URL encodes a token or claim value(s) using the salt provided in the envionment variable
-// REVOCATION_HASHING_SALT.
-func hashTokenClaim(h string) string {
-
-	if h == "" {
-		return ""
+// Returns the values of the claims joined with a '|'. The claims of unverified tokens can be anything, so it returns
+// false unless all of them are strings.
+func claimValues(claims map[string]interface{}, names []string) (string, bool) {
+	vals := make([]string, len(names))
+	for i, n := range names {
+		s, ok := claims[n].(string)
+		if !ok {
+			return "", false
+		}
+		vals[i] = s
 	}
-
-	salt := options.AppSettings.HashingSalt
-	buf := []byte(salt + h)
-	hash := sha256.New()
-	hash.Write(buf)
-	return base64.URLEncoding.EncodeToString(hash.Sum(nil))
-
+	return strings.Join(vals, "|"), true
 }
 
 // Metrics used to count the number of each type of revocation.
@@ -0,0 +1,95 @@
+package revoke
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/options"
+	"github.com/zalando/planb-tokeninfo/snapshot"
+)
+
+const (
+	snapshotFile         = "revocations.json"
+	metricsSnapshotError = "planb.tokeninfo.revocation.errors.snapshot"
+)
+
+// Stores the last known good revocations, used to start while the Revocation Provider is not reachable.
+type revocationsSnapshot struct {
+	URL         string        `json:"url"`
+	Revocations []*Revocation `json:"revocations"`
+}
+
+// Returns the path of the snapshot file or an empty string if snapshots are disabled (SNAPSHOT_DIR).
+func snapshotPath() string {
+	if options.AppSettings.SnapshotDir == "" {
+		return ""
+	}
+	return filepath.Join(options.AppSettings.SnapshotDir, snapshotFile)
+}
+
+// Saves all the revocations from the cache to the snapshot file.
+func (crp *CachingRevokeProvider) saveSnapshot() {
+	path := snapshotPath()
+	if path == "" {
+		return
+	}
+	s := &revocationsSnapshot{URL: crp.url, Revocations: crp.cache.Snapshot()}
+	if err := snapshot.Save(path, s); err != nil {
+		log.Printf("Failed to save the revocations snapshot %q: %v", path, err)
+		countSnapshotError()
+	}
+}
+
+// Fills the cache with the revocations from the snapshot file, unless it is older than SNAPSHOT_MAX_AGE.
+// FORCEREFRESH is added first, as it resets the last revocation timestamp of the cache.
+func (crp *CachingRevokeProvider) loadSnapshot() {
+	path := snapshotPath()
+	if path == "" {
+		return
+	}
+	s := &revocationsSnapshot{}
+	savedAt, err := snapshot.Load(path, options.AppSettings.SnapshotMaxAge, s)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Ignoring the revocations snapshot %q: %v", path, err)
+		countSnapshotError()
+		return
+	}
+	if s.URL != crp.url {
+		log.Printf("Ignoring the revocations snapshot %q of another provider %q", path, s.URL)
+		return
+	}
+
+	log.Printf("Loading %d revocations from the snapshot %q saved at %v...", len(s.Revocations), path, savedAt)
+	var revs []*Revocation
+	for _, r := range s.Revocations {
+		if r == nil || r.Data == nil {
+			continue
+		}
+		// JSON numbers are decoded as float64, but the cache stores timestamps as int
+		for k, v := range r.Data {
+			if f, ok := v.(float64); ok {
+				r.Data[k] = int(f)
+			}
+		}
+		if r.Type == REVOCATION_TYPE_FORCEREFRESH {
+			revs = append([]*Revocation{r}, revs...)
+		} else {
+			revs = append(revs, r)
+		}
+	}
+	for _, r := range revs {
+		crp.cache.Add(r)
+	}
+	crp.cache.Expire()
+}
+
+func countSnapshotError() {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(metricsSnapshotError, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
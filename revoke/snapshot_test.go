@@ -0,0 +1,72 @@
+package revoke
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestRevocationsSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revocations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string, maxAge time.Duration) {
+		options.AppSettings.SnapshotDir = dir
+		options.AppSettings.SnapshotMaxAge = maxAge
+	}(options.AppSettings.SnapshotDir, options.AppSettings.SnapshotMaxAge)
+	options.AppSettings.SnapshotDir = dir
+	options.AppSettings.SnapshotMaxAge = time.Hour
+
+	revokedAt := int(time.Now().Add(-1 * time.Hour).Unix())
+	j := fmt.Sprintf(`{
+		"meta": {"REFRESH_FROM": %d, "REFRESH_TIMESTAMP": %d},
+		"revocations": [
+			{"type": "TOKEN", "data": {"token_hash": "3AW57qxY0oO9RlVOW7zor7uUOFnoTNBSaYbEOYeJPRg=", "issued_before": %d}, "revoked_at": %d},
+			{"type": "CLAIM", "data": {"names": ["uid", "realm"], "value_hash": "+3sDm1MGB3+WGg7CzeMOBwse8V076MyYfNIF1W9A0B0=", "issued_before": %d}, "revoked_at": %d}
+		]
+	}`, revokedAt-60, revokedAt-30, revokedAt, revokedAt, revokedAt, revokedAt)
+
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, j)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	u, _ := url.Parse(server.URL)
+	NewCachingRevokeProvider(u).RefreshRevocations()
+	server.Close()
+
+	crp := NewCachingRevokeProvider(u)
+	r := crp.cache.Get("3AW57qxY0oO9RlVOW7zor7uUOFnoTNBSaYbEOYeJPRg=")
+	if r == nil || r.(*Revocation).Data["issued_before"] != revokedAt {
+		t.Errorf("Token revocation should have been loaded from the snapshot. Got %#v", r)
+	}
+	if names := crp.cache.GetClaimNames(); len(names) != 1 || names[0] != "uid|realm" {
+		t.Errorf("Claim names should have been loaded from the snapshot. Got %v", names)
+	}
+	if crp.cache.Get(REVOCATION_TYPE_FORCEREFRESH) == nil {
+		t.Error("Force refresh should have been loaded from the snapshot")
+	}
+	if ts := crp.cache.GetLastTS(); ts != revokedAt {
+		t.Errorf("Wrong last revocation timestamp. Wanted %d, got %d", revokedAt, ts)
+	}
+
+	other, _ := url.Parse("http://other.example.org")
+	if NewCachingRevokeProvider(other).cache.GetLastTS() != 0 {
+		t.Error("Snapshots of other revocation providers should be ignored")
+	}
+
+	options.AppSettings.SnapshotMaxAge = -time.Second
+	if NewCachingRevokeProvider(u).cache.GetLastTS() != 0 {
+		t.Error("Snapshots older than the maximum age should be ignored")
+	}
+}
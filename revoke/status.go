@@ -0,0 +1,40 @@
+package revoke
+
+import (
+	"sort"
+)
+
+// Status summarizes the contents of the revocation cache, for debugging.
+type Status struct {
+	Counts       map[string]int `json:"counts"`
+	LastTS       int            `json:"last_revocation_timestamp"`
+	Global       *Revocation    `json:"global"`
+	ForceRefresh *Revocation    `json:"force_refresh"`
+	ClaimNames   []string       `json:"claim_names"`
+	Streaming    bool           `json:"streaming"`
+}
+
+// Returns the number of revocations of each type, the last revocation timestamp used to poll the Revocation Provider,
+// the GLOBAL and FORCEREFRESH revocations (if any) and the claim names of the CLAIM revocations.
+func (crp *CachingRevokeProvider) Status() *Status {
+	s := &Status{
+		Counts:     make(map[string]int),
+		LastTS:     crp.cache.GetLastTS(),
+		ClaimNames: crp.cache.GetClaimNames(),
+		Streaming:  crp.isStreaming(),
+	}
+	for _, r := range crp.cache.Snapshot() {
+		s.Counts[r.Type]++
+		switch r.Type {
+		case REVOCATION_TYPE_GLOBAL:
+			s.Global = r
+		case REVOCATION_TYPE_FORCEREFRESH:
+			s.ForceRefresh = r
+		}
+	}
+	if s.ClaimNames == nil {
+		s.ClaimNames = []string{}
+	}
+	sort.Strings(s.ClaimNames)
+	return s
+}
@@ -0,0 +1,62 @@
+package revoke
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestStatus(t *testing.T) {
+	crp := &CachingRevokeProvider{url: "localhost", cache: NewCache()}
+	global := &Revocation{Type: REVOCATION_TYPE_GLOBAL, Data: map[string]interface{}{"issued_before": 100000, "revoked_at": 100000}}
+	crp.cache.Add(global)
+	crp.cache.Add(&Revocation{Type: REVOCATION_TYPE_TOKEN, Data: map[string]interface{}{"token_hash": "t1", "issued_before": 300000, "revoked_at": 300000}})
+	crp.cache.Add(&Revocation{Type: REVOCATION_TYPE_TOKEN, Data: map[string]interface{}{"token_hash": "t2", "issued_before": 200000, "revoked_at": 200000}})
+	crp.cache.Add(&Revocation{Type: REVOCATION_TYPE_CLAIM, Data: map[string]interface{}{"names": "uid|realm", "value_hash": "c1", "issued_before": 200000, "revoked_at": 200000}})
+	crp.cache.Add(&Revocation{Type: REVOCATION_TYPE_CLAIM, Data: map[string]interface{}{"names": "sub", "value_hash": "c2", "issued_before": 200000, "revoked_at": 200000}})
+
+	s := crp.Status()
+	want := &Status{
+		Counts:     map[string]int{REVOCATION_TYPE_GLOBAL: 1, REVOCATION_TYPE_TOKEN: 2, REVOCATION_TYPE_CLAIM: 2},
+		LastTS:     300000,
+		Global:     global,
+		ClaimNames: []string{"sub", "uid|realm"},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Wrong status.\nWanted %+v\nGot %+v", want, s)
+	}
+}
+
+func TestFindRevocation(t *testing.T) {
+	crp := &CachingRevokeProvider{url: "localhost", cache: NewCache()}
+	token := &Revocation{Type: REVOCATION_TYPE_TOKEN, Data: map[string]interface{}{"token_hash": hashValue(HASH_ALGORITHM_SHA256, options.AppSettings.HashingSalt, "foo"), "issued_before": 200000, "revoked_at": 200000}}
+	crp.cache.Add(token)
+	subject := &Revocation{Type: REVOCATION_TYPE_SUBJECT, Data: map[string]interface{}{"value_hash": hashValue(HASH_ALGORITHM_SHA256, options.AppSettings.HashingSalt, "jdoe"), "issued_before": 200000, "revoked_at": 200000}}
+	crp.cache.Add(subject)
+	claim := &Revocation{Type: REVOCATION_TYPE_CLAIM, Data: map[string]interface{}{"value_hash": hashValue(HASH_ALGORITHM_SHA256, options.AppSettings.HashingSalt, "alice|a1"), "names": "sub|uid", "issued_before": 200000, "revoked_at": 200000}}
+	crp.cache.Add(claim)
+	// only matched if the values of an incomplete group of claims were looked up
+	partial := &Revocation{Type: REVOCATION_TYPE_CLAIM, Data: map[string]interface{}{"value_hash": hashValue(HASH_ALGORITHM_SHA256, options.AppSettings.HashingSalt, "alice"), "names": "sub|uid", "issued_before": 200000, "revoked_at": 200000}}
+	crp.cache.Add(partial)
+
+	for _, test := range []struct {
+		raw    string
+		claims map[string]interface{}
+		want   *Revocation
+	}{
+		{"foo", nil, token},
+		{"bar", nil, nil},
+		{"a.b.c", jwt.MapClaims{"sub": "jdoe", "iat": 100000.0}, subject},
+		{"a.b.c", jwt.MapClaims{"sub": "jdoe", "iat": 300000.0}, nil},
+		{"a.b.c", jwt.MapClaims{"sub": "jdoe"}, nil},
+		{"a.b.c", jwt.MapClaims{"sub": "alice", "uid": "a1", "iat": 100000.0}, claim},
+		{"a.b.c", jwt.MapClaims{"sub": "alice", "iat": 100000.0}, nil},
+		{"a.b.c", jwt.MapClaims{"sub": "alice", "uid": 42.0, "iat": 100000.0}, nil},
+	} {
+		if got := crp.FindRevocation(test.raw, test.claims); got != test.want {
+			t.Errorf("Wrong revocation for %q %v. Wanted %#v, got %#v", test.raw, test.claims, test.want, got)
+		}
+	}
+}
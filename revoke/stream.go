@@ -0,0 +1,208 @@
+package revoke
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/ht"
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+const (
+	metricsStreamConnected = "planb.tokeninfo.revocation.stream.connected"
+	metricsStreamEvents    = "planb.tokeninfo.revocation.stream.events"
+	metricsStreamErrors    = "planb.tokeninfo.revocation.stream.errors"
+
+	// Largest Server-Sent Event line accepted from the revocation stream.
+	maxEventSize = 1 << 20
+)
+
+var (
+	streamFunc = func(crp *CachingRevokeProvider) { go crp.streamRevocations() }
+
+	// Time without any line, heartbeats included, after which the stream is considered dropped. Long-poll requests
+	// must also be answered within this time
+	streamIdleTimeout = 2 * time.Minute
+	// Minimum time between the start of two long-poll requests, so that servers answering right away aren't hammered
+	longPollMinInterval = time.Second
+
+	errStreamClosed = errors.New("Stream closed by the server")
+	errStreamIdle   = errors.New("Nothing received from the stream within the idle timeout")
+)
+
+// Subscribes to the revocation stream for as long as the process runs. When the stream drops, polling takes over
+// from the last revocation timestamp and the stream is opened again after REVOCATION_PROVIDER_REFRESH_INTERVAL.
+func (crp *CachingRevokeProvider) streamRevocations() {
+	// the stream stays open, so only the connection is limited by the timeouts. Reads are limited by streamIdleTimeout
+	client := ht.NewHTTPClient(0, options.AppSettings.HTTPClientTLSTimeout)
+	for {
+		err := crp.subscribe(client)
+		crp.setStreaming(false)
+		log.Printf("Revocation stream dropped, falling back to polling. %v", err)
+		countStream(metricsStreamErrors)
+		time.Sleep(options.AppSettings.RevocationProviderRefreshInterval)
+	}
+}
+
+// Requests the revocations from the stream URL since the last revocation timestamp. Server-Sent Events responses
+// (text/event-stream) are read until the connection is closed. Any other response is a long-poll response with the
+// same format as the Revocation Provider, after which the next request is sent, no sooner than longPollMinInterval
+// after the previous one; long-poll requests that end without new revocations should be answered with 204 No Content.
+func (crp *CachingRevokeProvider) subscribe(client *http.Client) error {
+	for {
+		start := time.Now()
+		if err := crp.request(client); err != nil {
+			return err
+		}
+		time.Sleep(longPollMinInterval - time.Since(start))
+	}
+}
+
+// Sends one request to the stream URL. It returns nil after a long-poll response, so that the next one can be sent.
+// The request is canceled, and the stream considered dropped, when nothing is received for streamIdleTimeout
+func (crp *CachingRevokeProvider) request(client *http.Client) error {
+	req, err := http.NewRequest("GET", crp.streamURL+"?from="+strconv.Itoa(crp.from()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream, application/json")
+	req.Header.Set("User-Agent", ht.UserAgent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idle := time.AfterFunc(streamIdleTimeout, func() {
+		crp.setStreaming(false)
+		cancel()
+	})
+	defer idle.Stop()
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return idleErr(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		crp.setStreaming(true)
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("Server returned status %s.", resp.Status)
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"):
+		log.Println("Subscribed to the revocation stream")
+		crp.setStreaming(true)
+		idle.Reset(streamIdleTimeout)
+		return idleErr(ctx, crp.readEvents(resp.Body, func() { idle.Reset(streamIdleTimeout) }))
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return idleErr(ctx, err)
+	}
+	jr := &jsonRevoke{}
+	if err := json.Unmarshal(body, jr); err != nil {
+		return err
+	}
+	crp.setStreaming(true)
+	countStream(metricsStreamEvents)
+	crp.applyRevocations(jr)
+	return nil
+}
+
+// Replaces the error of a request canceled by the idle timeout
+func idleErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return errStreamIdle
+	}
+	return err
+}
+
+// Reads Server-Sent Events until the stream ends. The data of "message" and "revocations" events has the same
+// format as the Revocation Provider responses and is applied as soon as the event is complete. Comments, usually
+// sent as heartbeats, and other events are ignored. received is called for every line read
+// Ref:
+//
+//	https://html.spec.whatwg.org/multipage/server-sent-events.html
+func (crp *CachingRevokeProvider) readEvents(r io.Reader, received func()) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxEventSize)
+
+	var (
+		event string
+		data  []string
+	)
+	for scanner.Scan() {
+		received()
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 && (event == "" || event == "message" || event == "revocations") {
+				crp.applyEvent(strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errStreamClosed
+}
+
+// Applies the revocations from the data of one event. Invalid events are logged and skipped, since the stream
+// itself is still usable.
+func (crp *CachingRevokeProvider) applyEvent(data string) {
+	jr := &jsonRevoke{}
+	if err := json.Unmarshal([]byte(data), jr); err != nil {
+		log.Println("Failed to unmarshall revocation event. " + err.Error())
+		countStream(metricsStreamErrors)
+		return
+	}
+	countStream(metricsStreamEvents)
+	crp.applyRevocations(jr)
+}
+
+func (crp *CachingRevokeProvider) isStreaming() bool {
+	return atomic.LoadInt32(&crp.streaming) == 1
+}
+
+func (crp *CachingRevokeProvider) setStreaming(connected bool) {
+	var v int32
+	if connected {
+		v = 1
+	}
+	atomic.StoreInt32(&crp.streaming, v)
+	if g, ok := metrics.DefaultRegistry.GetOrRegister(metricsStreamConnected, metrics.NewGauge).(metrics.Gauge); ok {
+		g.Update(int64(v))
+	}
+}
+
+func countStream(name string) {
+	if c, ok := metrics.DefaultRegistry.GetOrRegister(name, metrics.NewCounter).(metrics.Counter); ok {
+		c.Inc(1)
+	}
+}
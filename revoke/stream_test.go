@@ -0,0 +1,126 @@
+package revoke
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zalando/planb-tokeninfo/options"
+)
+
+func TestStreamEvents(t *testing.T) {
+	revokedAt := int(time.Now().Add(-1 * time.Hour).Unix())
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": heartbeat\n\n")
+		fmt.Fprintf(w, "event: revocations\ndata: {\"revocations\": [{\"type\": \"TOKEN\", \"revoked_at\": %d,\ndata:  \"data\": {\"token_hash\": \"t1\", \"issued_before\": %d}}]}\n\n", revokedAt, revokedAt)
+		fmt.Fprintf(w, "event: other\ndata: {\"revocations\": [{\"type\": \"TOKEN\", \"revoked_at\": %d, \"data\": {\"token_hash\": \"t2\", \"issued_before\": %d}}]}\n\n", revokedAt, revokedAt)
+		fmt.Fprint(w, "data: foo\n\n")
+		fmt.Fprintf(w, "data: {\"revocations\": [{\"type\": \"TOKEN\", \"revoked_at\": %d, \"data\": {\"token_hash\": \"t3\", \"issued_before\": %d}}]}\n\n", revokedAt, revokedAt)
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	polled := 0
+	poll := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		polled++
+		fmt.Fprint(w, `{"revocations": []}`)
+	}))
+	defer poll.Close()
+
+	crp := &CachingRevokeProvider{url: poll.URL, streamURL: server.URL, cache: NewCache()}
+	if err := crp.subscribe(http.DefaultClient); err != errStreamClosed {
+		t.Errorf("Wrong error when the stream ends. Wanted %v, got %v", errStreamClosed, err)
+	}
+	if crp.cache.Get("t1") == nil || crp.cache.Get("t3") == nil {
+		t.Error("Revocations from the stream events should have been added")
+	}
+	if crp.cache.Get("t2") != nil {
+		t.Error("Revocations from other events should be ignored")
+	}
+
+	crp.RefreshRevocations()
+	if polled != 0 {
+		t.Error("Polling should be skipped while the stream is connected")
+	}
+	crp.setStreaming(false)
+	crp.RefreshRevocations()
+	if polled != 1 {
+		t.Error("Polling should take over when the stream is not connected")
+	}
+}
+
+func TestStreamLongPoll(t *testing.T) {
+	defer func(d time.Duration) { longPollMinInterval = d }(longPollMinInterval)
+	longPollMinInterval = 50 * time.Millisecond
+
+	revokedAt := int(time.Now().Add(-1 * time.Hour).Unix())
+	var (
+		from []string
+		sent []time.Time
+	)
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		from = append(from, req.URL.Query().Get("from"))
+		sent = append(sent, time.Now())
+		switch len(from) {
+		case 1:
+			w.WriteHeader(http.StatusNoContent)
+		case 2:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"revocations": [{"type": "TOKEN", "revoked_at": %d, "data": {"token_hash": "t1", "issued_before": %d}}]}`, revokedAt, revokedAt)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	crp := &CachingRevokeProvider{url: server.URL, streamURL: server.URL, cache: NewCache()}
+	if err := crp.subscribe(http.DefaultClient); err == nil {
+		t.Error("Long-poll should stop when the server fails")
+	}
+	if crp.cache.Get("t1") == nil {
+		t.Error("Revocations from the long-poll response should have been added")
+	}
+	want := strconv.Itoa(revokedAt - int(options.AppSettings.RevocationRefreshTolerance.Seconds()))
+	if len(from) != 3 || from[2] != want {
+		t.Errorf("The next long-poll request should continue from the last revocation. Wanted %s, got %v", want, from)
+	}
+	for i := 1; i < len(sent); i++ {
+		if d := sent[i].Sub(sent[i-1]); d < longPollMinInterval/2 {
+			t.Errorf("Long-poll requests should be sent at least %v apart. Got %v", longPollMinInterval, d)
+		}
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	defer func(d time.Duration) { streamIdleTimeout = d }(streamIdleTimeout)
+	streamIdleTimeout = 100 * time.Millisecond
+
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(streamIdleTimeout / 2)
+		}
+		<-req.Context().Done()
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	crp := &CachingRevokeProvider{streamURL: server.URL, cache: NewCache()}
+	start := time.Now()
+	if err := crp.subscribe(http.DefaultClient); err != errStreamIdle {
+		t.Errorf("Wrong error when the stream is idle. Wanted %v, got %v", errStreamIdle, err)
+	}
+	if time.Since(start) < 3*streamIdleTimeout/2 {
+		t.Error("Heartbeats should keep the stream open")
+	}
+	if crp.isStreaming() {
+		t.Error("An idle stream should not be considered connected")
+	}
+}
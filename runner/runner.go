@@ -8,7 +8,10 @@ import (
 	"time"
 
 	gometrics "github.com/rcrowley/go-metrics"
+	"github.com/zalando/planb-tokeninfo/handlers/admin"
+	"github.com/zalando/planb-tokeninfo/handlers/batch"
 	"github.com/zalando/planb-tokeninfo/handlers/healthcheck"
+	"github.com/zalando/planb-tokeninfo/handlers/introspection"
 	"github.com/zalando/planb-tokeninfo/handlers/jwks"
 	"github.com/zalando/planb-tokeninfo/handlers/metrics"
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo"
@@ -16,7 +19,9 @@ import (
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo/jwt"
 	"github.com/zalando/planb-tokeninfo/handlers/tokeninfo/proxy"
 	"github.com/zalando/planb-tokeninfo/ht"
+	"github.com/zalando/planb-tokeninfo/keyloader"
 	"github.com/zalando/planb-tokeninfo/keyloader/openid"
+	"github.com/zalando/planb-tokeninfo/keyloader/static"
 	"github.com/zalando/planb-tokeninfo/options"
 	"github.com/zalando/planb-tokeninfo/revoke"
 )
@@ -32,25 +37,82 @@ func setupMetrics(s *options.Settings) {
 	}()
 }
 
+// setupAdmin starts the admin listener, separate from the application and metrics listeners
+func setupAdmin(s *options.Settings, crp *revoke.CachingRevokeProvider) {
+	log.Printf("Admin endpoints at %v for %d user(s)", s.AdminListenAddress, len(s.AdminCredentials))
+	h := admin.NewHandler(crp, s.AdminCredentials)
+	go func() {
+		log.Printf("ERROR: %s", http.ListenAndServe(s.AdminListenAddress, h))
+	}()
+}
+
+// newKeyLoader returns the loader for the key sources in the settings. Multiple sources are chained in order
+func newKeyLoader(settings *options.Settings) (keyloader.JWKLoader, error) {
+	var loaders []keyloader.JWKLoader
+	sources := settings.KeySources
+	if len(sources) == 0 {
+		sources = []string{options.KeySourceOpenID}
+	}
+	for _, source := range sources {
+		var (
+			kl  keyloader.JWKLoader
+			err error
+		)
+		switch source {
+		case options.KeySourceOpenID:
+			kl = openid.NewMultiIssuerLoader(settings.OpenIDProviders())
+		case options.KeySourceJWKSFile:
+			log.Printf("Loading keys from the JWKS file %s (refresh every %v)", settings.JWKSFile, settings.StaticKeysRefreshInterval)
+			kl, err = static.NewFileLoader(settings.JWKSFile, settings.StaticKeysIssuer, settings.StaticKeysRefreshInterval)
+		case options.KeySourcePEMDir:
+			log.Printf("Loading keys from the PEM files in %s (refresh every %v)", settings.PEMKeysDir, settings.StaticKeysRefreshInterval)
+			kl, err = static.NewPEMDirLoader(settings.PEMKeysDir, settings.StaticKeysIssuer, settings.StaticKeysRefreshInterval)
+		default:
+			err = fmt.Errorf("Unknown key source %q", source)
+		}
+		if err != nil {
+			return nil, err
+		}
+		loaders = append(loaders, kl)
+	}
+	if len(loaders) == 1 {
+		return loaders[0], nil
+	}
+	return keyloader.NewChainLoader(loaders...), nil
+}
+
 func Run(settings *options.Settings) {
 	log.Printf("Started server (%s) at %v, /metrics endpoint at %v\n",
 		version, settings.ListenAddress, settings.MetricsListenAddress)
 	ht.UserAgent = fmt.Sprintf("%v/%s", os.Args[0], version)
 	setupMetrics(settings)
 
+	crp := revoke.NewCachingRevokeProvider(settings.RevocationProviderUrl)
 	var ph http.Handler
 	if settings.UpstreamTokenInfoURL != nil {
-		ph = tokeninfoproxy.NewTokenInfoProxyHandler(settings.UpstreamTokenInfoURL, settings.UpstreamCacheMaxSize, settings.UpstreamCacheTTL, settings.UpstreamTimeout)
+		ph = tokeninfoproxy.NewTokenInfoProxyHandler(settings.UpstreamTokenInfoURL, settings.UpstreamCacheMaxSize, settings.UpstreamCacheTTL, settings.UpstreamTimeout, crp)
 	} else {
 		ph = errorall.NewErrorAllHandler()
 	}
-	kl := openid.NewCachingOpenIDProviderLoader(settings.OpenIDProviderConfigurationURL)
-	crp := revoke.NewCachingRevokeProvider(settings.RevocationProviderUrl)
+	kl, err := newKeyLoader(settings)
+	if err != nil {
+		log.Fatal("Failed to load the keys: ", err)
+	}
 	jh := jwthandler.New(kl, crp)
 
+	th := tokeninfo.NewHandler(ph, jh)
+
 	mux := http.NewServeMux()
 	mux.Handle("/health", healthcheck.NewHandler(kl, version))
-	mux.Handle("/oauth2/tokeninfo", tokeninfo.NewHandler(ph, jh))
+	mux.Handle("/oauth2/tokeninfo", th)
+	mux.Handle("/oauth2/tokeninfo/batch", batch.NewHandler(th, settings.BatchMaxSize))
+	if len(settings.IntrospectionClients) > 0 {
+		log.Printf("Token introspection enabled for %d client(s)", len(settings.IntrospectionClients))
+		mux.Handle("/oauth2/introspect", introspection.NewHandler(th, settings.IntrospectionClients))
+	}
 	mux.Handle("/oauth2/connect/keys", jwks.NewHandler(kl))
+	if settings.AdminListenAddress != "" {
+		setupAdmin(settings, crp)
+	}
 	log.Fatal(http.ListenAndServe(settings.ListenAddress, mux))
 }
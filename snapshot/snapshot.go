@@ -0,0 +1,97 @@
+/*
+Package snapshot persists state to local files, so that it survives restarts
+
+	Usage:
+
+	Save any value that can be marshaled to JSON with the Save() function
+
+		if err := snapshot.Save("/var/lib/planb/state.json", state); err != nil {
+			log.Println("Failed to save the snapshot: ", err)
+		}
+
+	The file is replaced atomically, so a crash while saving never leaves a partially written
+	snapshot behind. The content is stored together with its SHA-256 checksum and the time it
+	was saved
+
+	Restore the value with the Load() function, which fails if the file was modified or if it
+	is older than the maximum age
+
+		savedAt, err := snapshot.Load("/var/lib/planb/state.json", 24*time.Hour, &state)
+*/
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// ErrChecksumMismatch is returned when the content of the snapshot doesn't match its checksum
+	ErrChecksumMismatch = errors.New("Snapshot checksum mismatch")
+	// ErrTooOld is returned when the snapshot is older than the maximum age
+	ErrTooOld = errors.New("Snapshot is too old")
+)
+
+type envelope struct {
+	SavedAt  int64           `json:"saved_at"`
+	Checksum string          `json:"sha256"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Save writes v as JSON to the file at path. The content is written to a temporary file in the same directory
+// which is synced and then renamed to path
+func Save(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	buf, err := json.Marshal(&envelope{SavedAt: time.Now().Unix(), Checksum: hex.EncodeToString(sum[:]), Data: data})
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads the snapshot at path into v. It fails with ErrChecksumMismatch if the content was modified and with
+// ErrTooOld if it was saved more than maxAge ago. It returns the time the snapshot was saved
+func Load(path string, maxAge time.Duration, v interface{}) (time.Time, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	e := new(envelope)
+	if err = json.Unmarshal(buf, e); err != nil {
+		return time.Time{}, err
+	}
+	sum := sha256.Sum256(e.Data)
+	if hex.EncodeToString(sum[:]) != e.Checksum {
+		return time.Time{}, ErrChecksumMismatch
+	}
+	savedAt := time.Unix(e.SavedAt, 0)
+	if time.Since(savedAt) > maxAge {
+		return savedAt, ErrTooOld
+	}
+	return savedAt, json.Unmarshal(e.Data, v)
+}
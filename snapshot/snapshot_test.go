@@ -0,0 +1,60 @@
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type state struct {
+	Name  string            `json:"name"`
+	Items map[string]string `json:"items"`
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	want := state{Name: "<foo & bar>", Items: map[string]string{"a": "b"}}
+	if err = Save(path, want); err != nil {
+		t.Fatal("Failed to save the snapshot: ", err)
+	}
+
+	var got state
+	savedAt, err := Load(path, time.Minute, &got)
+	if err != nil {
+		t.Fatal("Failed to load the snapshot: ", err)
+	}
+	if got.Name != want.Name || got.Items["a"] != "b" {
+		t.Errorf("Wrong snapshot content. Wanted %v, got %v", want, got)
+	}
+	if time.Since(savedAt) > time.Minute {
+		t.Errorf("Wrong snapshot time %v", savedAt)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Temporary files should be removed. Got %d files", len(files))
+	}
+
+	if _, err = Load(path, -time.Second, &got); err != ErrTooOld {
+		t.Errorf("Wanted %v, got %v", ErrTooOld, err)
+	}
+
+	buf, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(path, bytes.Replace(buf, []byte(`"b"`), []byte(`"c"`), 1), 0644)
+	if _, err = Load(path, time.Minute, &got); err != ErrChecksumMismatch {
+		t.Errorf("Wanted %v, got %v", ErrChecksumMismatch, err)
+	}
+
+	if _, err = Load(filepath.Join(dir, "missing.json"), time.Minute, &got); !os.IsNotExist(err) {
+		t.Error("Missing snapshots should fail: ", err)
+	}
+}